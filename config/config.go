@@ -2,21 +2,25 @@ package config
 
 import (
 	"fmt"
+	"github.com/Montheankul-K/assessment-tax/packages/money"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
 )
 
 type IConfig interface {
 	App() IAppConfig
 	DB() IDBConfig
 	AdminAuth() IAdminAuth
+	Tax() ITaxConfig
 }
 
 type config struct {
 	app       *app
 	db        *db
 	adminAuth *adminAuth
+	tax       *taxConfig
 }
 
 type IAppConfig interface {
@@ -49,6 +53,16 @@ type adminAuth struct {
 	password string
 }
 
+type ITaxConfig interface {
+	RoundingMode() string
+	JobWorkers() int
+}
+
+type taxConfig struct {
+	roundingMode string
+	jobWorkers   int
+}
+
 func (c *config) App() IAppConfig {
 	return c.app
 }
@@ -61,6 +75,10 @@ func (c *config) AdminAuth() IAdminAuth {
 	return c.adminAuth
 }
 
+func (c *config) Tax() ITaxConfig {
+	return c.tax
+}
+
 func (a *app) Name() string {
 	return a.name
 }
@@ -85,6 +103,14 @@ func (a *adminAuth) Password() string {
 	return a.password
 }
 
+func (t *taxConfig) RoundingMode() string {
+	return t.roundingMode
+}
+
+func (t *taxConfig) JobWorkers() int {
+	return t.jobWorkers
+}
+
 func loadEnv(path string) {
 	err := godotenv.Load(path)
 	if err != nil {
@@ -117,6 +143,23 @@ func LoadConfig(path string, useEnv bool) (IConfig, error) {
 		return nil, fmt.Errorf("env variable ADMIN_PASSWORD not set")
 	}
 
+	roundingMode := os.Getenv("TAX_ROUNDING_MODE")
+	if roundingMode == "" {
+		roundingMode = money.RoundHalfUp
+	}
+	if !money.IsSupportedRoundingMode(roundingMode) {
+		return nil, fmt.Errorf("env variable TAX_ROUNDING_MODE must be %s or %s", money.RoundHalfUp, money.RoundHalfEven)
+	}
+
+	jobWorkers := 4
+	if value := os.Getenv("TAX_JOB_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return nil, fmt.Errorf("env variable TAX_JOB_WORKERS must be a positive number")
+		}
+		jobWorkers = workers
+	}
+
 	return &config{
 		app: &app{
 			name:    "k-taxes",
@@ -130,5 +173,9 @@ func LoadConfig(path string, useEnv bool) (IConfig, error) {
 			username: adminUsername,
 			password: adminPassword,
 		},
+		tax: &taxConfig{
+			roundingMode: roundingMode,
+			jobWorkers:   jobWorkers,
+		},
 	}, nil
 }
@@ -1,5 +1,27 @@
+DROP TABLE IF EXISTS tax_allowance_type;
 DROP TABLE IF EXISTS tax_allowance;
+DROP TABLE IF EXISTS tax_allowance_group;
+DROP TABLE IF EXISTS tax_expense;
+DROP TABLE IF EXISTS tax_minimum_tax;
+DROP TABLE IF EXISTS tax_dependent_rule;
 DROP TABLE IF EXISTS tax_level;
+DROP TABLE IF EXISTS tax_calculation;
+DROP TABLE IF EXISTS tax_job;
+
+CREATE TABLE tax_allowance_type
+(
+    id                bigserial NOT NULL,
+    created_at        timestamptz NULL,
+    updated_at        timestamptz NULL,
+    deleted_at        timestamptz NULL,
+    allowance_type    text      NOT NULL,
+    display_name      text      NOT NULL,
+    source            text      NOT NULL DEFAULT 'user',
+    validation_method text      NOT NULL DEFAULT 'range',
+    CONSTRAINT tax_allowance_type_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_allowance_type_deleted_at ON public.tax_allowance_type USING btree (deleted_at);
+CREATE UNIQUE INDEX idx_tax_allowance_type_allowance_type ON public.tax_allowance_type USING btree (allowance_type);
 
 CREATE TABLE tax_allowance
 (
@@ -7,34 +29,215 @@ CREATE TABLE tax_allowance
     created_at           timestamptz NULL,
     updated_at           timestamptz NULL,
     deleted_at           timestamptz NULL,
+    tax_year             integer   NOT NULL,
+    effective_from       timestamptz NOT NULL,
     allowance_type       text      NOT NULL,
-    min_allowance_amount numeric   NOT NULL,
-    max_allowance_amount numeric   NOT NULL,
+    allowance_group      text      NOT NULL DEFAULT '',
+    enabled              boolean   NOT NULL DEFAULT true,
+    min_allowance_amount numeric(10, 2) NOT NULL,
+    max_allowance_amount numeric(10, 2) NOT NULL,
+    max_income_percent   numeric(5, 2) NULL,
+    income_type          text      NOT NULL DEFAULT '',
+    deduction_multiplier numeric(5, 2) NULL,
+    admin_min_amount     numeric(10, 2) NULL,
+    admin_max_amount     numeric(10, 2) NULL,
     CONSTRAINT tax_allowance_pkey PRIMARY KEY (id)
 );
 CREATE INDEX idx_tax_allowance_deleted_at ON public.tax_allowance USING btree (deleted_at);
+CREATE INDEX idx_tax_allowance_tax_year ON public.tax_allowance USING btree (tax_year, allowance_type, effective_from);
+
+CREATE TABLE tax_allowance_group
+(
+    id              bigserial NOT NULL,
+    created_at      timestamptz NULL,
+    updated_at      timestamptz NULL,
+    deleted_at      timestamptz NULL,
+    tax_year        integer   NOT NULL,
+    effective_from  timestamptz NOT NULL,
+    allowance_group        text      NOT NULL,
+    max_amount             numeric(10, 2) NULL,
+    max_net_income_percent numeric(5, 2) NULL,
+    CONSTRAINT tax_allowance_group_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_allowance_group_deleted_at ON public.tax_allowance_group USING btree (deleted_at);
+CREATE INDEX idx_tax_allowance_group_tax_year ON public.tax_allowance_group USING btree (tax_year, allowance_group, effective_from);
+
+CREATE TABLE tax_expense
+(
+    id                 bigserial      NOT NULL,
+    created_at         timestamptz NULL,
+    updated_at         timestamptz NULL,
+    deleted_at         timestamptz NULL,
+    tax_year           integer        NOT NULL,
+    effective_from     timestamptz    NOT NULL,
+    income_type        text           NOT NULL,
+    expense_percent    numeric(10, 2) NOT NULL,
+    max_expense_amount numeric(10, 2) NULL,
+    CONSTRAINT tax_expense_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_expense_deleted_at ON public.tax_expense USING btree (deleted_at);
+CREATE INDEX idx_tax_expense_tax_year ON public.tax_expense USING btree (tax_year, income_type, effective_from);
+
+CREATE TABLE tax_minimum_tax
+(
+    id             bigserial      NOT NULL,
+    created_at     timestamptz NULL,
+    updated_at     timestamptz NULL,
+    deleted_at     timestamptz NULL,
+    tax_year       integer        NOT NULL,
+    effective_from timestamptz    NOT NULL,
+    min_income     numeric(10, 2) NOT NULL,
+    tax_percent    numeric(5, 2)  NOT NULL,
+    max_exempt_tax numeric(10, 2) NOT NULL,
+    CONSTRAINT tax_minimum_tax_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_minimum_tax_deleted_at ON public.tax_minimum_tax USING btree (deleted_at);
+CREATE INDEX idx_tax_minimum_tax_tax_year ON public.tax_minimum_tax USING btree (tax_year, effective_from);
+
+CREATE TABLE tax_dependent_rule
+(
+    id                    bigserial      NOT NULL,
+    created_at            timestamptz NULL,
+    updated_at            timestamptz NULL,
+    deleted_at            timestamptz NULL,
+    tax_year              integer        NOT NULL,
+    effective_from        timestamptz    NOT NULL,
+    max_parents           integer        NOT NULL,
+    min_parent_age        integer        NOT NULL,
+    max_child_age         integer        NOT NULL,
+    max_student_age       integer        NOT NULL,
+    later_child_born_from timestamptz    NOT NULL,
+    max_dependent_income  numeric(10, 2) NOT NULL,
+    CONSTRAINT tax_dependent_rule_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_dependent_rule_deleted_at ON public.tax_dependent_rule USING btree (deleted_at);
+CREATE INDEX idx_tax_dependent_rule_tax_year ON public.tax_dependent_rule USING btree (tax_year, effective_from);
 
 CREATE TABLE tax_level
 (
-    id          bigserial      NOT NULL,
-    created_at  timestamptz NULL,
-    updated_at  timestamptz NULL,
-    deleted_at  timestamptz NULL,
-    min_income  numeric(10, 2) NOT NULL,
-    max_income  numeric(10, 2) NOT NULL,
-    tax_percent numeric(10, 2) NOT NULL,
+    id             bigserial      NOT NULL,
+    created_at     timestamptz NULL,
+    updated_at     timestamptz NULL,
+    deleted_at     timestamptz NULL,
+    tax_year       integer        NOT NULL,
+    effective_from timestamptz    NOT NULL,
+    min_income     numeric(10, 2) NOT NULL,
+    max_income     numeric(10, 2) NULL,
+    tax_percent    numeric(10, 2) NOT NULL,
     CONSTRAINT tax_level_pkey PRIMARY KEY (id)
 );
 CREATE INDEX idx_tax_level_deleted_at ON public.tax_level USING btree (deleted_at);
+CREATE INDEX idx_tax_level_tax_year ON public.tax_level USING btree (tax_year, effective_from);
+
+CREATE TABLE tax_calculation
+(
+    id            bigserial      NOT NULL,
+    created_at    timestamptz NULL,
+    updated_at    timestamptz NULL,
+    deleted_at    timestamptz NULL,
+    source        text           NOT NULL,
+    tax_year      integer        NOT NULL,
+    effective_at  timestamptz    NOT NULL,
+    rounding_mode text           NOT NULL,
+    total_income  numeric(15, 2) NOT NULL,
+    total_tax     numeric(15, 2) NOT NULL,
+    tax_refund    numeric(15, 2) NOT NULL,
+    request       jsonb          NOT NULL,
+    response      jsonb          NOT NULL,
+    CONSTRAINT tax_calculation_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_calculation_deleted_at ON public.tax_calculation USING btree (deleted_at);
+CREATE INDEX idx_tax_calculation_source ON public.tax_calculation USING btree (source);
+CREATE INDEX idx_tax_calculation_tax_year ON public.tax_calculation USING btree (tax_year);
+
+CREATE TABLE tax_job
+(
+    id             bigserial   NOT NULL,
+    created_at     timestamptz NULL,
+    updated_at     timestamptz NULL,
+    deleted_at     timestamptz NULL,
+    status         text        NOT NULL DEFAULT 'pending',
+    total_rows     integer     NOT NULL,
+    processed_rows integer     NOT NULL DEFAULT 0,
+    message        text NULL,
+    result         jsonb NULL,
+    CONSTRAINT tax_job_pkey PRIMARY KEY (id)
+);
+CREATE INDEX idx_tax_job_deleted_at ON public.tax_job USING btree (deleted_at);
+
+INSERT INTO tax_allowance_type (allowance_type, display_name, source, validation_method)
+VALUES ('personal', 'ค่าลดหย่อนส่วนตัว', 'automatic', 'range'),
+       ('k-receipt', 'ช้อปลดภาษี', 'user', 'range'),
+       ('spouse', 'ค่าลดหย่อนคู่สมรส', 'dependents', 'range'),
+       ('child', 'ค่าลดหย่อนบุตร', 'dependents', 'range'),
+       ('later-child', 'ค่าลดหย่อนบุตรคนที่ 2 เป็นต้นไปที่เกิดตั้งแต่ปี 2561', 'dependents', 'range'),
+       ('parent', 'ค่าลดหย่อนบิดามารดา', 'dependents', 'range'),
+       ('disabled-dependent', 'ค่าลดหย่อนผู้พิการหรือทุพพลภาพ', 'dependents', 'range'),
+       ('income-exemption', 'เงินได้ที่ได้รับยกเว้นของผู้มีอายุ 65 ปีขึ้นไปหรือผู้พิการ', 'taxpayer', 'range');
+
+INSERT INTO tax_allowance_type (allowance_type, display_name, source, validation_method)
+VALUES ('life-insurance', 'เบี้ยประกันชีวิต', 'user', 'cap'),
+       ('health-insurance', 'เบี้ยประกันสุขภาพ', 'user', 'cap'),
+       ('provident-fund', 'เงินสะสมกองทุนสำรองเลี้ยงชีพ', 'user', 'cap'),
+       ('rmf', 'กองทุนรวมเพื่อการเลี้ยงชีพ (RMF)', 'user', 'cap'),
+       ('ssf', 'กองทุนรวมเพื่อการออม (SSF)', 'user', 'cap'),
+       ('social-security', 'เงินสมทบกองทุนประกันสังคม', 'user', 'cap'),
+       ('donation', 'เงินบริจาค', 'user', 'donation'),
+       ('education-donation', 'เงินบริจาคเพื่อการศึกษา', 'user', 'donation'),
+       ('hospital-donation', 'เงินบริจาคให้โรงพยาบาลรัฐ', 'user', 'donation');
+
+INSERT INTO tax_allowance (tax_year, effective_from, allowance_type, min_allowance_amount, max_allowance_amount)
+VALUES (2567, '2024-01-01 00:00:00+07', 'spouse', 0.00, 60000.00),
+       (2567, '2024-01-01 00:00:00+07', 'child', 0.00, 30000.00),
+       (2567, '2024-01-01 00:00:00+07', 'later-child', 0.00, 60000.00),
+       (2567, '2024-01-01 00:00:00+07', 'parent', 0.00, 30000.00),
+       (2567, '2024-01-01 00:00:00+07', 'disabled-dependent', 0.00, 60000.00),
+       (2567, '2024-01-01 00:00:00+07', 'income-exemption', 0.00, 190000.00),
+       (2567, '2024-01-01 00:00:00+07', 'social-security', 0.00, 9000.00);
+
+INSERT INTO tax_allowance (tax_year, effective_from, allowance_type, min_allowance_amount, max_allowance_amount, admin_min_amount, admin_max_amount)
+VALUES (2567, '2024-01-01 00:00:00+07', 'personal', 60000.00, 60000.00, 10000.00, 100000.00),
+       (2567, '2024-01-01 00:00:00+07', 'k-receipt', 0.00, 50000.00, 0.00, 100000.00);
+
+INSERT INTO tax_allowance (tax_year, effective_from, allowance_type, allowance_group, min_allowance_amount, max_allowance_amount)
+VALUES (2567, '2024-01-01 00:00:00+07', 'life-insurance', 'insurance', 0.00, 100000.00),
+       (2567, '2024-01-01 00:00:00+07', 'health-insurance', 'insurance', 0.00, 25000.00),
+       (2567, '2024-01-01 00:00:00+07', 'donation', 'donation', 0.00, 100000.00);
+
+INSERT INTO tax_allowance (tax_year, effective_from, allowance_type, allowance_group, min_allowance_amount, max_allowance_amount, max_income_percent, income_type)
+VALUES (2567, '2024-01-01 00:00:00+07', 'provident-fund', 'retirement', 0.00, 500000.00, 15.00, 'salary'),
+       (2567, '2024-01-01 00:00:00+07', 'rmf', 'retirement', 0.00, 500000.00, 30.00, ''),
+       (2567, '2024-01-01 00:00:00+07', 'ssf', 'retirement', 0.00, 200000.00, 30.00, '');
+
+INSERT INTO tax_allowance (tax_year, effective_from, allowance_type, allowance_group, min_allowance_amount, max_allowance_amount, deduction_multiplier)
+VALUES (2567, '2024-01-01 00:00:00+07', 'education-donation', 'donation', 0.00, 100000.00, 2.00),
+       (2567, '2024-01-01 00:00:00+07', 'hospital-donation', 'donation', 0.00, 100000.00, 2.00);
+
+INSERT INTO tax_allowance_group (tax_year, effective_from, allowance_group, max_amount)
+VALUES (2567, '2024-01-01 00:00:00+07', 'insurance', 100000.00),
+       (2567, '2024-01-01 00:00:00+07', 'retirement', 500000.00);
+
+INSERT INTO tax_allowance_group (tax_year, effective_from, allowance_group, max_net_income_percent)
+VALUES (2567, '2024-01-01 00:00:00+07', 'donation', 10.00);
+
+INSERT INTO tax_expense (tax_year, effective_from, income_type, expense_percent, max_expense_amount)
+VALUES (2567, '2024-01-01 00:00:00+07', 'salary', 50.00, 100000.00),
+       (2567, '2024-01-01 00:00:00+07', 'copyright', 50.00, 100000.00),
+       (2567, '2024-01-01 00:00:00+07', 'rental', 30.00, NULL),
+       (2567, '2024-01-01 00:00:00+07', 'professional', 30.00, NULL),
+       (2567, '2024-01-01 00:00:00+07', 'contract', 60.00, NULL),
+       (2567, '2024-01-01 00:00:00+07', 'business', 60.00, NULL);
+
+INSERT INTO tax_minimum_tax (tax_year, effective_from, min_income, tax_percent, max_exempt_tax)
+VALUES (2567, '2024-01-01 00:00:00+07', 120000.00, 0.50, 5000.00);
+
+INSERT INTO tax_dependent_rule (tax_year, effective_from, max_parents, min_parent_age, max_child_age, max_student_age,
+                                later_child_born_from, max_dependent_income)
+VALUES (2567, '2024-01-01 00:00:00+07', 4, 60, 20, 25, '2018-01-01 00:00:00+07', 30000.00);
 
-INSERT INTO tax_allowance (allowance_type, min_allowance_amount, max_allowance_amount)
-VALUES ('personal', 60000.00, 60000.00),
-       ('donation', 0.00, 100000.00),
-       ('k-receipt', 0.00, 50000.00);
-
-INSERT INTO tax_level (min_income, max_income, tax_percent)
-VALUES (0.00, 150000.00, 0.00),
-       (150001.00, 500000.00, 10.00),
-       (500001.00, 1000000.00, 15.00),
-       (1000001.00, 2000000.00, 20.00),
-       (2000001.00, 2000001.00, 35.00)
\ No newline at end of file
+INSERT INTO tax_level (tax_year, effective_from, min_income, max_income, tax_percent)
+VALUES (2567, '2024-01-01 00:00:00+07', 0.00, 150000.00, 0.00),
+       (2567, '2024-01-01 00:00:00+07', 150001.00, 500000.00, 10.00),
+       (2567, '2024-01-01 00:00:00+07', 500001.00, 1000000.00, 15.00),
+       (2567, '2024-01-01 00:00:00+07', 1000001.00, 2000000.00, 20.00),
+       (2567, '2024-01-01 00:00:00+07', 2000001.00, NULL, 35.00)
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"github.com/Montheankul-K/assessment-tax/modules/server"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/packages/database"
+	"github.com/shopspring/decimal"
 	"log"
 )
 
@@ -14,8 +15,11 @@ func main() {
 		log.Fatal("Error loading config: ", err)
 	}
 
+	// amounts in the responses are json numbers instead of strings, this is global so it is set once before the server starts.
+	decimal.MarshalJSONWithoutQuotes = true
+
 	db := database.DBConnect(cfg.DB())
-	err = db.AutoMigrate(&tax.TaxAllowance{}, &tax.TaxLevel{})
+	err = db.AutoMigrate(&tax.TaxAllowanceType{}, &tax.TaxAllowance{}, &tax.TaxAllowanceGroup{}, &tax.TaxExpense{}, &tax.TaxMinimumTax{}, &tax.TaxDependentRule{}, &tax.TaxLevel{}, &tax.TaxCalculation{}, &tax.TaxJob{})
 	if err != nil {
 		log.Fatal("Error migrate database tables: ", err)
 	}
@@ -1,5 +1,108 @@
 package admin
 
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
 type DeductionAmount struct {
-	Amount float64 `json:"amount"`
+	TaxYear       int             `json:"taxYear,omitempty"`
+	EffectiveFrom time.Time       `json:"effectiveFrom"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+type TaxLevel struct {
+	ID         uint             `json:"id,omitempty" param:"id"`
+	MinIncome  decimal.Decimal  `json:"minIncome"`
+	MaxIncome  *decimal.Decimal `json:"maxIncome"`
+	TaxPercent decimal.Decimal  `json:"taxPercent"`
+}
+
+type TaxLevelRequest struct {
+	TaxYear       int       `json:"taxYear,omitempty" query:"taxYear"`
+	EffectiveFrom time.Time `json:"effectiveFrom" query:"effectiveFrom"`
+	TaxLevel
+}
+
+// DeleteTaxLevelRequest only comes from the path and the query, a delete has no body.
+type DeleteTaxLevelRequest struct {
+	ID            uint      `param:"id"`
+	EffectiveFrom time.Time `query:"effectiveFrom"`
+}
+
+type TaxLevels struct {
+	TaxYear       int        `json:"taxYear,omitempty"`
+	EffectiveFrom time.Time  `json:"effectiveFrom"`
+	TaxLevels     []TaxLevel `json:"taxLevels"`
+}
+
+type RuleFilter struct {
+	TaxYear     int       `query:"taxYear"`
+	EffectiveAt time.Time `query:"effectiveAt"`
+}
+
+type TaxExpense struct {
+	IncomeType     string           `json:"incomeType" param:"incomeType"`
+	TaxYear        int              `json:"taxYear,omitempty"`
+	EffectiveFrom  time.Time        `json:"effectiveFrom"`
+	ExpensePercent decimal.Decimal  `json:"expensePercent"`
+	MaxAmount      *decimal.Decimal `json:"maxAmount"`
+}
+
+type AllowanceType struct {
+	AllowanceType    string           `json:"allowanceType"`
+	DisplayName      string           `json:"displayName"`
+	Source           string           `json:"source"`
+	ValidationMethod string           `json:"validationMethod"`
+	AllowanceGroup   string           `json:"allowanceGroup,omitempty"`
+	Enabled          bool             `json:"enabled"`
+	MinAmount        *decimal.Decimal `json:"minAmount,omitempty"`
+	MaxAmount        *decimal.Decimal `json:"maxAmount,omitempty"`
+}
+
+// DisableAllowanceTypeRequest only comes from the path and the query, a delete has no body.
+type DisableAllowanceTypeRequest struct {
+	AllowanceType string    `param:"allowanceType"`
+	TaxYear       int       `query:"taxYear"`
+	EffectiveFrom time.Time `query:"effectiveFrom"`
+}
+
+type AllowanceTypeRequest struct {
+	AllowanceType    string           `json:"allowanceType"`
+	DisplayName      string           `json:"displayName"`
+	Source           string           `json:"source"`
+	ValidationMethod string           `json:"validationMethod"`
+	AllowanceGroup   string           `json:"allowanceGroup,omitempty"`
+	TaxYear          int              `json:"taxYear,omitempty"`
+	EffectiveFrom    time.Time        `json:"effectiveFrom"`
+	MinAmount        decimal.Decimal  `json:"minAmount"`
+	MaxAmount        decimal.Decimal  `json:"maxAmount"`
+	MaxIncomePercent *decimal.Decimal `json:"maxIncomePercent,omitempty"`
+	IncomeType       string           `json:"incomeType,omitempty"`
+	// DeductionMultiplier is how many times a donation counts, such as 2 for education.
+	DeductionMultiplier *decimal.Decimal `json:"deductionMultiplier,omitempty"`
+	// AdminMinAmount and AdminMaxAmount bound the amount that can be set later, the amount must be greater than
+	// AdminMinAmount and not greater than AdminMaxAmount.
+	AdminMinAmount *decimal.Decimal `json:"adminMinAmount,omitempty"`
+	AdminMaxAmount *decimal.Decimal `json:"adminMaxAmount,omitempty"`
+}
+
+type MinimumTax struct {
+	TaxYear       int             `json:"taxYear,omitempty"`
+	EffectiveFrom time.Time       `json:"effectiveFrom"`
+	MinIncome     decimal.Decimal `json:"minIncome"`
+	TaxPercent    decimal.Decimal `json:"taxPercent"`
+	MaxExemptTax  decimal.Decimal `json:"maxExemptTax"`
+}
+
+// DependentRule limits who can be claimed as a dependent, LaterChildBornFrom is a Gregorian date.
+type DependentRule struct {
+	TaxYear            int             `json:"taxYear,omitempty"`
+	EffectiveFrom      time.Time       `json:"effectiveFrom"`
+	MaxParents         int             `json:"maxParents"`
+	MinParentAge       int             `json:"minParentAge"`
+	MaxChildAge        int             `json:"maxChildAge"`
+	MaxStudentAge      int             `json:"maxStudentAge"`
+	LaterChildBornFrom time.Time       `json:"laterChildBornFrom"`
+	MaxDependentIncome decimal.Decimal `json:"maxDependentIncome"`
 }
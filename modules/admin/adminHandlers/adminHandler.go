@@ -1,17 +1,32 @@
 package adminHandlers
 
 import (
+	"errors"
 	"github.com/Montheankul-K/assessment-tax/config"
 	"github.com/Montheankul-K/assessment-tax/modules/admin"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"time"
 )
 
 type IAdminHandler interface {
-	SetPersonalDeduction(c echo.Context) error
-	SetKReceiptDeduction(c echo.Context) error
+	SetDeduction(c echo.Context) error
+	GetAllowanceTypes(c echo.Context) error
+	CreateAllowanceType(c echo.Context) error
+	DisableAllowanceType(c echo.Context) error
+	GetTaxLevels(c echo.Context) error
+	CreateTaxLevel(c echo.Context) error
+	UpdateTaxLevel(c echo.Context) error
+	DeleteTaxLevel(c echo.Context) error
+	SetTaxLevels(c echo.Context) error
+	GetTaxExpenses(c echo.Context) error
+	SetTaxExpense(c echo.Context) error
+	GetMinimumTax(c echo.Context) error
+	SetMinimumTax(c echo.Context) error
+	GetDependentRule(c echo.Context) error
+	SetDependentRule(c echo.Context) error
 }
 
 type adminHandler struct {
@@ -26,52 +41,473 @@ func AdminHandler(config config.IConfig, taxUsecase taxUsecases.ITaxUsecase) IAd
 	}
 }
 
-func (h *adminHandler) setDeduction(amount float64, allowanceType string) (float64, error) {
+func (h *adminHandler) setDeduction(req *admin.DeductionAmount, allowanceType string) (*admin.DeductionAmount, error) {
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return nil, err
+	}
+
 	newDeduction := tax.SetNewDeductionAmount{
-		AllowanceFilter: tax.AllowanceFilter{
-			AllowanceType: allowanceType,
-		},
-		NewDeductionAmount: amount,
+		AllowanceType:      allowanceType,
+		TaxYear:            taxYear,
+		EffectiveFrom:      req.EffectiveFrom,
+		NewDeductionAmount: req.Amount,
 	}
 
 	result, err := h.taxUsecase.SetDeduction(&newDeduction)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return result, nil
+	return &admin.DeductionAmount{
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		Amount:        result,
+	}, nil
 }
 
-func (h *adminHandler) SetPersonalDeduction(c echo.Context) error {
+func (h *adminHandler) SetDeduction(c echo.Context) error {
 	req, ok := c.Get("request").(*admin.DeductionAmount)
 	if !ok {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
 	}
 
-	result, err := h.setDeduction(req.Amount, "personal")
+	result, err := h.setDeduction(req, c.Param("allowanceType"))
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
+}
+
+func (h *adminHandler) toAllowanceType(allowanceType *tax.TaxAllowanceType, rule tax.RuleFilter) admin.AllowanceType {
+	result := admin.AllowanceType{
+		AllowanceType:    allowanceType.AllowanceType,
+		DisplayName:      allowanceType.DisplayName,
+		Source:           allowanceType.Source,
+		ValidationMethod: allowanceType.ValidationMethod,
+	}
+
+	// an allowance type without a version in the tax year can't be used, so it is shown as disabled
+	if allowance, err := h.taxUsecase.FindAllowance(allowanceType.AllowanceType, rule); err == nil {
+		result.AllowanceGroup, result.Enabled = allowance.AllowanceGroup, allowance.Enabled
+		result.MinAmount, result.MaxAmount = &allowance.MinAllowanceAmount, &allowance.MaxAllowanceAmount
+	}
+
+	return result
+}
+
+func (h *adminHandler) GetAllowanceTypes(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.RuleFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	allowanceTypes, err := h.taxUsecase.ListAllowanceTypes()
 	if err != nil {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 	}
 
-	responseData := admin.DeductionAmount{
-		Amount: result,
+	rule := tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveAt}
+	result := make([]admin.AllowanceType, 0, len(allowanceTypes))
+	for i := range allowanceTypes {
+		result = append(result, h.toAllowanceType(&allowanceTypes[i], rule))
 	}
-	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, responseData)
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
 }
 
-func (h *adminHandler) SetKReceiptDeduction(c echo.Context) error {
-	req, ok := c.Get("request").(*admin.DeductionAmount)
+func (h *adminHandler) CreateAllowanceType(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.AllowanceTypeRequest)
 	if !ok {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
 	}
 
-	result, err := h.setDeduction(req.Amount, "k-receipt")
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	allowanceType, err := h.taxUsecase.CreateAllowanceType(&tax.SetNewAllowanceType{
+		AllowanceType:       req.AllowanceType,
+		DisplayName:         req.DisplayName,
+		Source:              req.Source,
+		ValidationMethod:    req.ValidationMethod,
+		AllowanceGroup:      req.AllowanceGroup,
+		TaxYear:             taxYear,
+		EffectiveFrom:       req.EffectiveFrom,
+		MinAllowanceAmount:  req.MinAmount,
+		MaxAllowanceAmount:  req.MaxAmount,
+		MaxIncomePercent:    req.MaxIncomePercent,
+		IncomeType:          req.IncomeType,
+		DeductionMultiplier: req.DeductionMultiplier,
+		AdminMinAmount:      req.AdminMinAmount,
+		AdminMaxAmount:      req.AdminMaxAmount,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	result := h.toAllowanceType(allowanceType, tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveFrom})
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusCreated, result)
+}
+
+func (h *adminHandler) DisableAllowanceType(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.DisableAllowanceTypeRequest)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.taxUsecase.DisableAllowanceType(&tax.DisableAllowance{
+		AllowanceType: req.AllowanceType,
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+	}); err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	allowanceType, err := h.taxUsecase.FindAllowanceType(req.AllowanceType)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	result := h.toAllowanceType(allowanceType, tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveFrom})
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
+}
+
+func (h *adminHandler) toTaxLevels(taxYear int, effectiveFrom time.Time, taxLevels []tax.TaxLevel) *admin.TaxLevels {
+	result := make([]admin.TaxLevel, 0, len(taxLevels))
+	for _, level := range taxLevels {
+		result = append(result, admin.TaxLevel{
+			ID:         level.ID,
+			MinIncome:  level.MinIncome,
+			MaxIncome:  level.MaxIncome,
+			TaxPercent: level.TaxPercent,
+		})
+	}
+
+	return &admin.TaxLevels{
+		TaxYear:       taxYear,
+		EffectiveFrom: effectiveFrom,
+		TaxLevels:     result,
+	}
+}
+
+// writeTaxYear lets a write start the rules of a new tax year, only an empty tax year falls back to the current one.
+func (h *adminHandler) writeTaxYear(taxYear int) (int, error) {
+	if taxYear != 0 {
+		return taxYear, nil
+	}
+
+	return h.taxUsecase.ResolveTaxYear(taxYear)
+}
+
+func (h *adminHandler) errorStatus(err error) int {
+	switch {
+	case errors.Is(err, tax.ErrInvalidTaxLevels), errors.Is(err, tax.ErrAllowanceTypeUnavailable), errors.Is(err, tax.ErrInvalidDeductionAmount):
+		return http.StatusBadRequest
+	case errors.Is(err, tax.ErrTaxLevelNotFound), errors.Is(err, tax.ErrAllowanceTypeNotFound), errors.Is(err, tax.ErrTaxExpenseNotFound), errors.Is(err, tax.ErrMinimumTaxNotFound), errors.Is(err, tax.ErrDependentRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tax.ErrAllowanceTypeExists), errors.Is(err, tax.ErrTaxLevelVersionExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *adminHandler) GetTaxLevels(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.RuleFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	taxLevels, err := h.taxUsecase.ListTaxLevels(tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveAt})
 	if err != nil {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 	}
 
-	responseData := admin.DeductionAmount{
-		Amount: result,
+	var effectiveFrom time.Time
+	if len(taxLevels) > 0 {
+		effectiveFrom = taxLevels[0].EffectiveFrom
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toTaxLevels(taxYear, effectiveFrom, taxLevels))
+}
+
+func (h *adminHandler) CreateTaxLevel(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.TaxLevelRequest)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	taxLevels, err := h.taxUsecase.CreateTaxLevel(&tax.SetNewTaxLevel{
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		MinIncome:     req.MinIncome,
+		MaxIncome:     req.MaxIncome,
+		TaxPercent:    req.TaxPercent,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusCreated, h.toTaxLevels(taxYear, req.EffectiveFrom, taxLevels))
+}
+
+func (h *adminHandler) UpdateTaxLevel(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.TaxLevelRequest)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxLevels, err := h.taxUsecase.UpdateTaxLevel(req.ID, &tax.SetNewTaxLevel{
+		EffectiveFrom: req.EffectiveFrom,
+		MinIncome:     req.MinIncome,
+		MaxIncome:     req.MaxIncome,
+		TaxPercent:    req.TaxPercent,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toTaxLevels(taxLevels[0].TaxYear, req.EffectiveFrom, taxLevels))
+}
+
+func (h *adminHandler) DeleteTaxLevel(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.DeleteTaxLevelRequest)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxLevels, err := h.taxUsecase.DeleteTaxLevel(req.ID, req.EffectiveFrom)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
 	}
-	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, responseData)
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toTaxLevels(taxLevels[0].TaxYear, req.EffectiveFrom, taxLevels))
+}
+
+func (h *adminHandler) SetTaxLevels(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.TaxLevels)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	newTaxLevels := make([]tax.TaxLevel, 0, len(req.TaxLevels))
+	for _, level := range req.TaxLevels {
+		newTaxLevels = append(newTaxLevels, tax.TaxLevel{
+			MinIncome:  level.MinIncome,
+			MaxIncome:  level.MaxIncome,
+			TaxPercent: level.TaxPercent,
+		})
+	}
+
+	taxLevels, err := h.taxUsecase.SetTaxLevels(&tax.SetNewTaxLevels{
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		TaxLevels:     newTaxLevels,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toTaxLevels(taxYear, req.EffectiveFrom, taxLevels))
+}
+
+func (h *adminHandler) toTaxExpense(taxExpense *tax.TaxExpense) admin.TaxExpense {
+	return admin.TaxExpense{
+		IncomeType:     taxExpense.IncomeType,
+		TaxYear:        taxExpense.TaxYear,
+		EffectiveFrom:  taxExpense.EffectiveFrom,
+		ExpensePercent: taxExpense.ExpensePercent,
+		MaxAmount:      taxExpense.MaxExpenseAmount,
+	}
+}
+
+func (h *adminHandler) GetTaxExpenses(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.RuleFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	taxExpenses, err := h.taxUsecase.ListTaxExpenses(tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveAt})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
+	}
+
+	result := make([]admin.TaxExpense, 0, len(taxExpenses))
+	for i := range taxExpenses {
+		result = append(result, h.toTaxExpense(&taxExpenses[i]))
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
+}
+
+func (h *adminHandler) SetTaxExpense(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.TaxExpense)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := h.taxUsecase.SetTaxExpense(&tax.SetNewTaxExpense{
+		IncomeType:       req.IncomeType,
+		TaxYear:          taxYear,
+		EffectiveFrom:    req.EffectiveFrom,
+		ExpensePercent:   req.ExpensePercent,
+		MaxExpenseAmount: req.MaxAmount,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusCreated, h.toTaxExpense(result))
+}
+
+func (h *adminHandler) toMinimumTax(minimumTax *tax.TaxMinimumTax) admin.MinimumTax {
+	return admin.MinimumTax{
+		TaxYear:       minimumTax.TaxYear,
+		EffectiveFrom: minimumTax.EffectiveFrom,
+		MinIncome:     minimumTax.MinIncome,
+		TaxPercent:    minimumTax.TaxPercent,
+		MaxExemptTax:  minimumTax.MaxExemptTax,
+	}
+}
+
+func (h *adminHandler) GetMinimumTax(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.RuleFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := h.taxUsecase.GetMinimumTax(tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveAt})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toMinimumTax(result))
+}
+
+func (h *adminHandler) SetMinimumTax(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.MinimumTax)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := h.taxUsecase.SetMinimumTax(&tax.SetNewMinimumTax{
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		MinIncome:     req.MinIncome,
+		TaxPercent:    req.TaxPercent,
+		MaxExemptTax:  req.MaxExemptTax,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusCreated, h.toMinimumTax(result))
+}
+
+func (h *adminHandler) toDependentRule(dependentRule *tax.TaxDependentRule) admin.DependentRule {
+	return admin.DependentRule{
+		TaxYear:            dependentRule.TaxYear,
+		EffectiveFrom:      dependentRule.EffectiveFrom,
+		MaxParents:         dependentRule.MaxParents,
+		MinParentAge:       dependentRule.MinParentAge,
+		MaxChildAge:        dependentRule.MaxChildAge,
+		MaxStudentAge:      dependentRule.MaxStudentAge,
+		LaterChildBornFrom: dependentRule.LaterChildBornFrom,
+		MaxDependentIncome: dependentRule.MaxDependentIncome,
+	}
+}
+
+func (h *adminHandler) GetDependentRule(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.RuleFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.taxUsecase.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := h.taxUsecase.GetDependentRule(tax.RuleFilter{TaxYear: taxYear, EffectiveAt: req.EffectiveAt})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, h.toDependentRule(result))
+}
+
+func (h *adminHandler) SetDependentRule(c echo.Context) error {
+	req, ok := c.Get("request").(*admin.DependentRule)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	taxYear, err := h.writeTaxYear(req.TaxYear)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	result, err := h.taxUsecase.SetDependentRule(&tax.SetNewDependentRule{
+		TaxYear:            taxYear,
+		EffectiveFrom:      req.EffectiveFrom,
+		MaxParents:         req.MaxParents,
+		MinParentAge:       req.MinParentAge,
+		MaxChildAge:        req.MaxChildAge,
+		MaxStudentAge:      req.MaxStudentAge,
+		LaterChildBornFrom: req.LaterChildBornFrom,
+		MaxDependentIncome: req.MaxDependentIncome,
+	})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusCreated, h.toDependentRule(result))
 }
@@ -1,27 +1,32 @@
 package adminHandlers
 
 import (
+	"fmt"
 	"github.com/Montheankul-K/assessment-tax/config"
 	"github.com/Montheankul-K/assessment-tax/modules/admin"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type MockConfig struct {
 	mockAppConfig *MockAppConfig
 	mockDBConfig  *MockDBConfig
 	mockAdminAuth *MockAdminAuth
+	mockTaxConfig *MockTaxConfig
 }
 
 type MockAppConfig struct{}
 type MockDBConfig struct{}
 type MockAdminAuth struct{}
+type MockTaxConfig struct{}
 
 func (m *MockConfig) App() config.IAppConfig {
 	return m.mockAppConfig
@@ -35,6 +40,10 @@ func (m *MockConfig) AdminAuth() config.IAdminAuth {
 	return m.mockAdminAuth
 }
 
+func (m *MockConfig) Tax() config.ITaxConfig {
+	return m.mockTaxConfig
+}
+
 func (m *MockAppConfig) Name() string {
 	return "name"
 }
@@ -59,73 +68,221 @@ func (m *MockAdminAuth) Password() string {
 	return "password"
 }
 
+func (m *MockTaxConfig) RoundingMode() string {
+	return "half-up"
+}
+
+func (m *MockTaxConfig) JobWorkers() int {
+	return 1
+}
+
 type MockTaxUsecase struct {
 	mock.Mock
 }
 
-func (m *MockTaxUsecase) FindBaseline(allowanceType string) (float64, float64, error) {
-	args := m.Called(allowanceType)
-	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+func (m *MockTaxUsecase) ResolveTaxYear(taxYear int) (int, error) {
+	args := m.Called(taxYear)
+	return args.Get(0).(int), args.Error(1)
 }
 
-func (m *MockTaxUsecase) FindTaxPercent(totalIncome float64) (float64, error) {
-	args := m.Called(totalIncome)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) FindBaseline(allowanceType string, rule tax.RuleFilter) (decimal.Decimal, decimal.Decimal, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).(decimal.Decimal), args.Error(2)
 }
 
-func (m *MockTaxUsecase) FindMaxIncomeAndPercent() (float64, float64, error) {
-	args := m.Called()
-	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+func (m *MockTaxUsecase) FindAllowance(allowanceType string, rule tax.RuleFilter) (*tax.TaxAllowance, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(*tax.TaxAllowance), args.Error(1)
 }
 
-func (m *MockTaxUsecase) CalculateTaxByTaxLevel(income float64) (float64, error) {
-	args := m.Called(income)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) CalculateTaxByTaxLevel(income decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, []taxUsecases.EachTaxLevel, error) {
+	args := m.Called(income, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel), args.Error(2)
 }
 
-func (m *MockTaxUsecase) GetTaxLevel() ([]taxUsecases.EachTaxLevel, error) {
-	args := m.Called()
+func (m *MockTaxUsecase) WalkTaxLevels(income decimal.Decimal, taxLevels []taxUsecases.EachTaxLevel) (decimal.Decimal, []taxUsecases.EachTaxLevel) {
+	args := m.Called(income, taxLevels)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel)
+}
+
+func (m *MockTaxUsecase) GetTaxLevel(rule tax.RuleFilter) ([]taxUsecases.EachTaxLevel, error) {
+	args := m.Called(rule)
 	return args.Get(0).([]taxUsecases.EachTaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (float64, error) {
+func (m *MockTaxUsecase) ListTaxLevels(rule tax.RuleFilter) ([]tax.TaxLevel, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateTaxLevel(req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
 	args := m.Called(req)
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreasePersonalAllowance(totalIncome float64) (float64, error) {
-	args := m.Called(totalIncome)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) UpdateTaxLevel(id uint, req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	args := m.Called(id, req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreaseWHT(tax, wht float64) float64 {
-	args := m.Called(tax, wht)
-	return args.Get(0).(float64)
+func (m *MockTaxUsecase) DeleteTaxLevel(id uint, effectiveFrom time.Time) ([]tax.TaxLevel, error) {
+	args := m.Called(id, effectiveFrom)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
+	args := m.Called(req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ValidateTaxLevels(taxLevels []tax.TaxLevel) error {
+	args := m.Called(taxLevels)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	args := m.Called(req)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListTaxExpenses(rule tax.RuleFilter) ([]tax.TaxExpense, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateExpense(income decimal.Decimal, incomeType string, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(income, incomeType, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetMinimumTax(rule tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreaseAllowance(tax float64, allowances []taxUsecases.TaxAllowanceDetails) float64 {
-	args := m.Called(tax, allowances)
-	return args.Get(0).(float64)
+func (m *MockTaxUsecase) CalculateMinimumTax(incomes []taxUsecases.TaxIncomeResponse, taxCredit decimal.Decimal, rule tax.RuleFilter) (*decimal.Decimal, error) {
+	args := m.Called(incomes, taxCredit, rule)
+	return args.Get(0).(*decimal.Decimal), args.Error(1)
 }
 
-func (m *MockTaxUsecase) ConstructTaxLevels(maxIncomeAmount float64, taxLevels []tax.TaxLevel) []taxUsecases.EachTaxLevel {
-	args := m.Called(maxIncomeAmount, taxLevels)
+func (m *MockTaxUsecase) GetDependentRule(rule tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	args := m.Called(allowanceType)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	args := m.Called()
+	return args.Get(0).([]tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DisableAllowanceType(req *tax.DisableAllowance) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAutomaticAllowances(totalIncome decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(totalIncome, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DecreaseWHT(tax, wht, taxCredit decimal.Decimal) decimal.Decimal {
+	args := m.Called(tax, wht, taxCredit)
+	return args.Get(0).(decimal.Decimal)
+}
+
+func (m *MockTaxUsecase) ValidateAllowance(allowance taxUsecases.TaxAllowanceDetails, rule tax.RuleFilter) error {
+	args := m.Called(allowance, rule)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAllowance(income decimal.Decimal, req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, []taxUsecases.TaxAllowanceDeduction, error) {
+	args := m.Called(income, req)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.TaxAllowanceDeduction), args.Error(2)
+}
+
+func (m *MockTaxUsecase) ConstructTaxLevels(taxLevels []tax.TaxLevel) []taxUsecases.EachTaxLevel {
+	args := m.Called(taxLevels)
 	return args.Get(0).([]taxUsecases.EachTaxLevel)
 }
 
-func (m *MockTaxUsecase) SetValueToTaxLevel(taxLevels []taxUsecases.EachTaxLevel, tax float64) ([]taxUsecases.TaxLevelResponse, error) {
-	args := m.Called(taxLevels, tax)
-	return args.Get(0).([]taxUsecases.TaxLevelResponse), args.Error(1)
+func (m *MockTaxUsecase) SetValueToTaxLevel(taxLevels []taxUsecases.EachTaxLevel) []taxUsecases.TaxLevelResponse {
+	args := m.Called(taxLevels)
+	return args.Get(0).([]taxUsecases.TaxLevelResponse)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequest(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequestFields(req *taxUsecases.CalculateTaxRequest) []taxUsecases.RowError {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.RowError)
+}
+
+func (m *MockTaxUsecase) ValidateDependents(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
 }
 
-func (m *MockTaxUsecase) GetTaxLevelDetails(tax float64) ([]taxUsecases.TaxLevelResponse, error) {
-	args := m.Called(tax)
-	return args.Get(0).([]taxUsecases.TaxLevelResponse), args.Error(1)
+func (m *MockTaxUsecase) DependentAllowances(req *taxUsecases.CalculateTaxRequest) ([]taxUsecases.TaxAllowanceDetails, error) {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.TaxAllowanceDetails), args.Error(1)
 }
 
-func (m *MockTaxUsecase) CalculateTaxWithoutWHT(req *taxUsecases.CalculateTaxRequest) (float64, error) {
+func (m *MockTaxUsecase) IncomeExemption(req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, error) {
 	args := m.Called(req)
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateTaxWithoutWHT(req *taxUsecases.CalculateTaxRequest) (*taxUsecases.TaxResult, error) {
+	args := m.Called(req)
+	return args.Get(0).(*taxUsecases.TaxResult), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateBulkTax(req *taxUsecases.CalculateTaxRequest, source string) (taxUsecases.TaxCalculationRecord, error) {
+	args := m.Called(req, source)
+	return args.Get(0).(taxUsecases.TaxCalculationRecord), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SaveTaxCalculations(records []taxUsecases.TaxCalculationRecord) ([]tax.TaxCalculation, error) {
+	args := m.Called(records)
+	return args.Get(0).([]tax.TaxCalculation), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetTaxCalculation(id uint) (*taxUsecases.TaxCalculationResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*taxUsecases.TaxCalculationResponse), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListTaxCalculations(req *taxUsecases.TaxCalculationFilter) (*taxUsecases.TaxCalculationListResponse, error) {
+	args := m.Called(req)
+	return args.Get(0).(*taxUsecases.TaxCalculationListResponse), args.Error(1)
 }
 
 func setupEchoContext() (ctx echo.Context, recorder *httptest.ResponseRecorder) {
@@ -145,11 +302,16 @@ func TestAdminHandler_SetPersonalDeduction(t *testing.T) {
 	}
 
 	c, rec := setupEchoContext()
-	requestData := &admin.DeductionAmount{Amount: 70000.0}
+	requestData := &admin.DeductionAmount{Amount: decimal.NewFromInt(70000)}
 	c.Set("request", requestData)
+	c.SetParamNames("allowanceType")
+	c.SetParamValues("personal")
 
-	mockTaxUsecase.On("SetDeduction", mock.Anything).Return(float64(70000.0), nil)
-	err := handler.SetPersonalDeduction(c)
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetDeduction", mock.MatchedBy(func(req *tax.SetNewDeductionAmount) bool {
+		return req.AllowanceType == "personal"
+	})).Return(decimal.NewFromInt(70000), nil)
+	err := handler.SetDeduction(c)
 
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
@@ -165,12 +327,319 @@ func TestAdminHandler_SetKReceiptDeduction(t *testing.T) {
 	}
 
 	c, rec := setupEchoContext()
-	requestData := &admin.DeductionAmount{Amount: 70000.0}
+	requestData := &admin.DeductionAmount{Amount: decimal.NewFromInt(70000)}
 	c.Set("request", requestData)
+	c.SetParamNames("allowanceType")
+	c.SetParamValues("k-receipt")
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetDeduction", mock.MatchedBy(func(req *tax.SetNewDeductionAmount) bool {
+		return req.AllowanceType == "k-receipt"
+	})).Return(decimal.NewFromInt(70000), nil)
+	err := handler.SetDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAdminHandler_SetDeduction_BelowMinAmount(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.DeductionAmount{Amount: decimal.NewFromInt(5000)}
+	c.Set("request", requestData)
+	c.SetParamNames("allowanceType")
+	c.SetParamValues("social-security")
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetDeduction", mock.Anything).Return(decimal.Zero, fmt.Errorf("%w: max amount 5000 of social-security is less than its min amount 9000", tax.ErrInvalidDeductionAmount))
+	err := handler.SetDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminHandler_CreateTaxLevel(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.TaxLevelRequest{TaxLevel: admin.TaxLevel{MinIncome: decimal.Zero, TaxPercent: decimal.NewFromInt(10)}}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("CreateTaxLevel", mock.Anything).Return([]tax.TaxLevel{
+		{MinIncome: decimal.Zero, TaxPercent: decimal.NewFromInt(10)},
+	}, nil)
+	err := handler.CreateTaxLevel(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestAdminHandler_SetTaxLevels_InvalidTaxLevels(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.TaxLevels{TaxYear: 2567, TaxLevels: []admin.TaxLevel{
+		{MinIncome: decimal.NewFromInt(100), TaxPercent: decimal.NewFromInt(10)},
+	}}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("SetTaxLevels", mock.Anything).Return([]tax.TaxLevel(nil), tax.ErrInvalidTaxLevels)
+	err := handler.SetTaxLevels(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
 
-	mockTaxUsecase.On("SetDeduction", mock.Anything).Return(float64(70000.0), nil)
-	err := handler.SetKReceiptDeduction(c)
+func TestAdminHandler_SetTaxLevels_VersionExists(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.TaxLevels{TaxYear: 2567, TaxLevels: []admin.TaxLevel{
+		{MinIncome: decimal.Zero, TaxPercent: decimal.NewFromInt(10)},
+	}}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("SetTaxLevels", mock.Anything).Return([]tax.TaxLevel(nil), fmt.Errorf("failed to set tax level: %w", tax.ErrTaxLevelVersionExists))
+	err := handler.SetTaxLevels(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestAdminHandler_DeleteTaxLevel_NotFound(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.DeleteTaxLevelRequest{ID: 9}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("DeleteTaxLevel", uint(9), mock.Anything).Return([]tax.TaxLevel(nil), tax.ErrTaxLevelNotFound)
+	err := handler.DeleteTaxLevel(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminHandler_SetDeduction_DisabledAllowanceType(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.DeductionAmount{Amount: decimal.NewFromInt(70000)}
+	c.Set("request", requestData)
+	c.SetParamNames("allowanceType")
+	c.SetParamValues("life-insurance")
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetDeduction", mock.Anything).Return(decimal.Zero, tax.ErrAllowanceTypeUnavailable)
+	err := handler.SetDeduction(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAdminHandler_SetTaxExpense(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	maxAmount := decimal.NewFromInt(100000)
+	requestData := &admin.TaxExpense{IncomeType: tax.IncomeTypeSalary, ExpensePercent: decimal.NewFromInt(50), MaxAmount: &maxAmount}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetTaxExpense", mock.MatchedBy(func(req *tax.SetNewTaxExpense) bool {
+		return req.IncomeType == tax.IncomeTypeSalary && req.TaxYear == 2567
+	})).Return(&tax.TaxExpense{IncomeType: tax.IncomeTypeSalary, TaxYear: 2567, ExpensePercent: decimal.NewFromInt(50), MaxExpenseAmount: &maxAmount}, nil)
+	err := handler.SetTaxExpense(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockTaxUsecase.AssertExpectations(t)
+}
+
+func TestAdminHandler_SetMinimumTax(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.MinimumTax{MinIncome: decimal.NewFromInt(120000), TaxPercent: decimal.NewFromFloat(0.5), MaxExemptTax: decimal.NewFromInt(5000)}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetMinimumTax", mock.MatchedBy(func(req *tax.SetNewMinimumTax) bool {
+		return req.TaxYear == 2567 && req.TaxPercent.Equal(decimal.NewFromFloat(0.5))
+	})).Return(&tax.TaxMinimumTax{TaxYear: 2567, MinIncome: decimal.NewFromInt(120000), TaxPercent: decimal.NewFromFloat(0.5), MaxExemptTax: decimal.NewFromInt(5000)}, nil)
+	err := handler.SetMinimumTax(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockTaxUsecase.AssertExpectations(t)
+}
+
+func TestAdminHandler_SetDependentRule(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	laterChildBornFrom := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	requestData := &admin.DependentRule{MaxParents: 4, MinParentAge: 60, MaxChildAge: 20, MaxStudentAge: 25, LaterChildBornFrom: laterChildBornFrom, MaxDependentIncome: decimal.NewFromInt(30000)}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("SetDependentRule", mock.MatchedBy(func(req *tax.SetNewDependentRule) bool {
+		return req.TaxYear == 2567 && req.MaxParents == 4 && req.LaterChildBornFrom.Equal(laterChildBornFrom)
+	})).Return(&tax.TaxDependentRule{TaxYear: 2567, MaxParents: 4, MinParentAge: 60, MaxChildAge: 20, MaxStudentAge: 25, LaterChildBornFrom: laterChildBornFrom, MaxDependentIncome: decimal.NewFromInt(30000)}, nil)
+	err := handler.SetDependentRule(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockTaxUsecase.AssertExpectations(t)
+}
+
+func TestAdminHandler_GetMinimumTax_NotFound(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	c.Set("request", &admin.RuleFilter{TaxYear: 2566})
+
+	mockTaxUsecase.On("ResolveTaxYear", 2566).Return(2566, nil)
+	mockTaxUsecase.On("GetMinimumTax", mock.Anything).Return((*tax.TaxMinimumTax)(nil), fmt.Errorf("failed to get minimum tax: %w", tax.ErrMinimumTaxNotFound))
+	err := handler.GetMinimumTax(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockTaxUsecase.AssertExpectations(t)
+}
+
+func TestAdminHandler_CreateAllowanceType(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	requestData := &admin.AllowanceTypeRequest{
+		AllowanceType:    "life-insurance",
+		DisplayName:      "เบี้ยประกันชีวิต",
+		Source:           tax.AllowanceSourceUser,
+		ValidationMethod: tax.AllowanceValidationCap,
+		TaxYear:          2567,
+		MaxAmount:        decimal.NewFromInt(100000),
+	}
+	c.Set("request", requestData)
+
+	mockTaxUsecase.On("CreateAllowanceType", mock.Anything).Return(&tax.TaxAllowanceType{
+		AllowanceType:    "life-insurance",
+		DisplayName:      "เบี้ยประกันชีวิต",
+		Source:           tax.AllowanceSourceUser,
+		ValidationMethod: tax.AllowanceValidationCap,
+	}, nil)
+	mockTaxUsecase.On("FindAllowance", "life-insurance", mock.Anything).Return(&tax.TaxAllowance{
+		AllowanceType:      "life-insurance",
+		Enabled:            true,
+		MinAllowanceAmount: decimal.Zero,
+		MaxAllowanceAmount: decimal.NewFromInt(100000),
+	}, nil)
+	err := handler.CreateAllowanceType(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"allowanceType":"life-insurance","displayName":"เบี้ยประกันชีวิต","source":"user","validationMethod":"cap","enabled":true,"minAmount":"0","maxAmount":"100000"}`, rec.Body.String())
+}
+
+func TestAdminHandler_DisableAllowanceType(t *testing.T) {
+	mockConfig := &MockConfig{}
+	mockTaxUsecase := &MockTaxUsecase{}
+
+	handler := &adminHandler{
+		config:     mockConfig,
+		taxUsecase: mockTaxUsecase,
+	}
+
+	c, rec := setupEchoContext()
+	effectiveFrom := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+	c.Set("request", &admin.DisableAllowanceTypeRequest{AllowanceType: "k-receipt", EffectiveFrom: effectiveFrom})
+
+	mockTaxUsecase.On("ResolveTaxYear", 0).Return(2567, nil)
+	mockTaxUsecase.On("DisableAllowanceType", &tax.DisableAllowance{AllowanceType: "k-receipt", TaxYear: 2567, EffectiveFrom: effectiveFrom}).Return(nil)
+	mockTaxUsecase.On("FindAllowanceType", "k-receipt").Return(&tax.TaxAllowanceType{
+		AllowanceType:    "k-receipt",
+		DisplayName:      "ช้อปลดภาษี",
+		Source:           tax.AllowanceSourceUser,
+		ValidationMethod: tax.AllowanceValidationRange,
+	}, nil)
+	mockTaxUsecase.On("FindAllowance", "k-receipt", tax.RuleFilter{TaxYear: 2567, EffectiveAt: effectiveFrom}).Return(&tax.TaxAllowance{
+		AllowanceType:      "k-receipt",
+		Enabled:            false,
+		MinAllowanceAmount: decimal.Zero,
+		MaxAllowanceAmount: decimal.NewFromInt(50000),
+	}, nil)
+	err := handler.DisableAllowanceType(c)
 
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"allowanceType":"k-receipt","displayName":"ช้อปลดภาษี","source":"user","validationMethod":"range","enabled":false,"minAmount":"0","maxAmount":"50000"}`, rec.Body.String())
+	mockTaxUsecase.AssertExpectations(t)
 }
@@ -8,16 +8,30 @@ import (
 	"github.com/Montheankul-K/assessment-tax/modules/admin"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
+	"github.com/Montheankul-K/assessment-tax/packages/csvinput"
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"strconv"
+	"sort"
+	"strings"
+	"time"
 )
 
 type IMiddlewareHandler interface {
 	ValidateCalculateTaxRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateTaxCalculationFilter(next echo.HandlerFunc) echo.HandlerFunc
 	ValidateSetDeductionRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateRuleFilter(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateTaxLevelRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateAllowanceTypeRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateDisableAllowanceTypeRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateSetTaxLevelsRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateDeleteTaxLevelRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateTaxExpenseRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateMinimumTaxRequest(next echo.HandlerFunc) echo.HandlerFunc
+	ValidateDependentRuleRequest(next echo.HandlerFunc) echo.HandlerFunc
 	GetDataFromTaxCSV(next echo.HandlerFunc) echo.HandlerFunc
 	ChangeStructFormat(next echo.HandlerFunc) echo.HandlerFunc
 	ValidateTaxFromCSV(next echo.HandlerFunc) echo.HandlerFunc
@@ -43,7 +57,11 @@ func (m *middlewareHandler) ValidateCalculateTaxRequest(next echo.HandlerFunc) e
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
 		}
 
-		if err := m.validateCalculateTaxRequest(req); err != nil {
+		if err := m.taxUsecase.ValidateCalculateTaxRequest(req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.taxUsecase.ValidateDependents(req); err != nil {
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
 		}
 
@@ -52,71 +70,226 @@ func (m *middlewareHandler) ValidateCalculateTaxRequest(next echo.HandlerFunc) e
 	}
 }
 
-func (m *middlewareHandler) validateCalculateTaxRequest(req *taxUsecases.CalculateTaxRequest) error {
-	if req.TotalIncome <= 0 {
-		return errors.New("total income must be gather than zero")
-	}
+func (m *middlewareHandler) ValidateTaxCalculationFilter(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := &taxUsecases.TaxCalculationFilter{Page: 1, PageSize: 20}
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
 
-	if req.Wht < 0 || req.Wht > req.TotalIncome {
-		return errors.New("wht must be between 0 and total income")
+		if req.Page < 1 || req.PageSize < 1 || req.PageSize > 100 {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "page must be at least 1 and page size must be between 1 and 100")
+		}
+
+		if req.Source != "" && req.Source != tax.CalculationSourceAPI && req.Source != tax.CalculationSourceCSV && req.Source != tax.CalculationSourceNDJSON {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, fmt.Sprintf("source must be %s, %s or %s", tax.CalculationSourceAPI, tax.CalculationSourceCSV, tax.CalculationSourceNDJSON))
+		}
+
+		c.Set("request", req)
+		return next(c)
 	}
+}
 
-	for _, allowance := range req.Allowances {
-		if err := m.validateAllowance(&allowance); err != nil {
-			return err
+func (m *middlewareHandler) ValidateSetDeductionRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req *admin.DeductionAmount
+		err := c.Bind(&req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateDeductionAmount(req.Amount); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
 		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+// validateDeductionAmount only rejects a negative amount, the bounds of each allowance type are kept on its tax
+// allowance and checked when the new version is created.
+func (m *middlewareHandler) validateDeductionAmount(amount decimal.Decimal) error {
+	if amount.IsNegative() {
+		return errors.New("amount must not be negative")
 	}
 
 	return nil
 }
 
-func (m *middlewareHandler) validateAllowance(allowance *taxUsecases.TaxAllowanceDetails) error {
-	minAmount, maxAmount, err := m.findBaselineAmount(allowance.AllowanceType)
-	if err != nil {
-		return err
+// validateEffectiveFrom defaults a missing effective date to now, a date in the past is rejected because a new version
+// must not change the rules of the results that were already returned.
+func (m *middlewareHandler) validateEffectiveFrom(effectiveFrom *time.Time) error {
+	now := time.Now()
+	if effectiveFrom.IsZero() {
+		*effectiveFrom = now
+		return nil
 	}
 
-	switch allowance.AllowanceType {
-	case "donation":
-		return m.validateDonationAllowance(allowance.Amount, minAmount, maxAmount)
-	case "k-receipt":
-		return m.validateKReceiptAllowance(allowance.Amount, minAmount, maxAmount)
-	default:
-		return errors.New("invalid allowance type")
+	if effectiveFrom.Before(now) {
+		return errors.New("effective from must not be in the past")
 	}
+
+	return nil
 }
 
-func (m *middlewareHandler) findBaselineAmount(allowanceType string) (float64, float64, error) {
+func (m *middlewareHandler) ValidateRuleFilter(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.RuleFilter)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if req.EffectiveAt.IsZero() {
+			req.EffectiveAt = time.Now()
+		}
 
-	return m.taxUsecase.FindBaseline(allowanceType)
+		c.Set("request", req)
+		return next(c)
+	}
 }
 
-func (m *middlewareHandler) validateDonationAllowance(amount, minAmount, maxAmount float64) error {
-	if amount < minAmount || amount > maxAmount {
-		return errors.New("donation amount must be between 0 and 100000")
+func (m *middlewareHandler) ValidateTaxLevelRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.TaxLevelRequest)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateTaxLevel(&req.TaxLevel); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
 	}
+}
 
-	return nil
+func (m *middlewareHandler) ValidateDeleteTaxLevelRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.DeleteTaxLevelRequest)
+		if err := (&echo.DefaultBinder{}).BindPathParams(c, req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if req.ID == 0 {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "invalid tax level id")
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
 }
 
-func (m *middlewareHandler) validateKReceiptAllowance(amount, minAmount, maxAmount float64) error {
-	if amount < minAmount || amount > maxAmount {
-		return fmt.Errorf("k-receipt amount must be between 0 and %.1f", maxAmount)
+func (m *middlewareHandler) ValidateSetTaxLevelsRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.TaxLevels)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		for i := range req.TaxLevels {
+			if err := m.validateTaxLevel(&req.TaxLevels[i]); err != nil {
+				return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+			}
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) validateTaxLevel(level *admin.TaxLevel) error {
+	if level.MinIncome.IsNegative() {
+		return errors.New("min income must not be negative")
+	}
+
+	if level.MaxIncome != nil && level.MaxIncome.LessThanOrEqual(level.MinIncome) {
+		return errors.New("max income must be greater than min income")
+	}
+
+	if level.TaxPercent.IsNegative() || level.TaxPercent.GreaterThan(decimal.NewFromInt(100)) {
+		return errors.New("tax percent must be between 0 and 100")
 	}
 
 	return nil
 }
 
-func (m *middlewareHandler) ValidateSetDeductionRequest(next echo.HandlerFunc) echo.HandlerFunc {
+func (m *middlewareHandler) ValidateTaxExpenseRequest(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var req *admin.DeductionAmount
-		err := c.Bind(&req)
+		req := new(admin.TaxExpense)
+		err := c.Bind(req)
 		if err != nil {
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
 		}
 
-		if req.Amount > 100000 {
-			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "req shouldn't be gather than 100000")
+		if !tax.IsIncomeType(req.IncomeType) {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, fmt.Sprintf("income type must be one of %s", strings.Join(tax.IncomeTypes, ", ")))
+		}
+
+		if expenseType := tax.ExpenseIncomeType(req.IncomeType); expenseType != req.IncomeType {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, fmt.Sprintf("%s income uses the expense of %s", req.IncomeType, expenseType))
+		}
+
+		if req.ExpensePercent.IsNegative() || req.ExpensePercent.GreaterThan(decimal.NewFromInt(100)) {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "expense percent must be between 0 and 100")
+		}
+
+		if req.MaxAmount != nil && req.MaxAmount.IsNegative() {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "max amount must not be negative")
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) ValidateMinimumTaxRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.MinimumTax)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if req.TaxPercent.IsNegative() || req.TaxPercent.GreaterThan(decimal.NewFromInt(100)) {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "tax percent must be between 0 and 100")
+		}
+
+		if req.MinIncome.IsNegative() || req.MaxExemptTax.IsNegative() {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "min income and max exempt tax must not be negative")
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
 		}
 
 		c.Set("request", req)
@@ -124,8 +297,152 @@ func (m *middlewareHandler) ValidateSetDeductionRequest(next echo.HandlerFunc) e
 	}
 }
 
+func (m *middlewareHandler) ValidateDependentRuleRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.DependentRule)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if req.MaxParents < 0 || req.MinParentAge < 0 || req.MaxChildAge <= 0 {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "max parents and min parent age must not be negative and max child age must be greater than zero")
+		}
+
+		if req.MaxStudentAge < req.MaxChildAge {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "max student age must not be less than max child age")
+		}
+
+		if req.LaterChildBornFrom.IsZero() {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "later child born from is required")
+		}
+
+		if req.MaxDependentIncome.IsNegative() {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "max dependent income must not be negative")
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) ValidateAllowanceTypeRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.AllowanceTypeRequest)
+		err := c.Bind(req)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if req.Source == "" {
+			req.Source = tax.AllowanceSourceUser
+		}
+
+		if req.ValidationMethod == "" {
+			req.ValidationMethod = tax.AllowanceValidationRange
+		}
+
+		if err := m.validateAllowanceTypeRequest(req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) ValidateDisableAllowanceTypeRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(admin.DisableAllowanceTypeRequest)
+		if err := (&echo.DefaultBinder{}).BindPathParams(c, req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, req); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		if err := m.validateEffectiveFrom(&req.EffectiveFrom); err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) validateAllowanceTypeRequest(req *admin.AllowanceTypeRequest) error {
+	if req.AllowanceType == "" || req.DisplayName == "" {
+		return errors.New("allowance type and display name are required")
+	}
+
+	if req.Source != tax.AllowanceSourceUser && req.Source != tax.AllowanceSourceAutomatic {
+		return fmt.Errorf("source must be %s or %s", tax.AllowanceSourceUser, tax.AllowanceSourceAutomatic)
+	}
+
+	if _, ok := taxUsecases.FindAllowanceRule(req.AllowanceType, req.ValidationMethod); !ok {
+		return fmt.Errorf("allowance rule for %s not found", req.ValidationMethod)
+	}
+
+	if req.MinAmount.IsNegative() || req.MaxAmount.LessThan(req.MinAmount) {
+		return errors.New("min amount must not be negative or greater than max amount")
+	}
+
+	if req.MaxIncomePercent != nil && (req.MaxIncomePercent.IsNegative() || req.MaxIncomePercent.GreaterThan(decimal.NewFromInt(100))) {
+		return errors.New("max income percent must be between 0 and 100")
+	}
+
+	if req.IncomeType != "" && !tax.IsIncomeType(req.IncomeType) {
+		return fmt.Errorf("income type must be one of %s", strings.Join(tax.IncomeTypes, ", "))
+	}
+
+	if req.DeductionMultiplier != nil && !req.DeductionMultiplier.IsPositive() {
+		return errors.New("deduction multiplier must be greater than 0")
+	}
+
+	if req.AdminMinAmount != nil && req.AdminMinAmount.IsNegative() {
+		return errors.New("admin min amount must not be negative")
+	}
+
+	if req.AdminMinAmount != nil && req.AdminMaxAmount != nil && !req.AdminMaxAmount.GreaterThan(*req.AdminMinAmount) {
+		return errors.New("admin max amount must be greater than admin min amount")
+	}
+
+	return nil
+}
+
+// taxCSVHeader is the position of each column in the file, every column that is not a known column is an allowance type.
+type taxCSVHeader struct {
+	columns     []string
+	totalIncome int
+	wht         int
+	reference   int
+	allowances  map[int]string
+}
+
 func (m *middlewareHandler) GetDataFromTaxCSV(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		mode := c.FormValue("mode")
+		if mode == "" {
+			mode = tax.CSVModeStrict
+		}
+		if mode != tax.CSVModeStrict && mode != tax.CSVModePartial {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, fmt.Sprintf("mode must be %s or %s", tax.CSVModeStrict, tax.CSVModePartial))
+		}
+
+		encoding := c.FormValue("encoding")
+		if encoding != "" && !csvinput.IsSupportedEncoding(encoding) {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, fmt.Sprintf("encoding must be %s, %s, %s or %s", csvinput.EncodingAuto, csvinput.EncodingUTF8, csvinput.EncodingTIS620, csvinput.EncodingWindows874))
+		}
+
 		file, err := c.FormFile("taxes")
 		if err != nil {
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
@@ -141,50 +458,170 @@ func (m *middlewareHandler) GetDataFromTaxCSV(next echo.HandlerFunc) echo.Handle
 			}
 		}(src)
 
-		reader := csv.NewReader(src)
+		reader, err := csvinput.NewReader(src, encoding)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		}
+		reader.FieldsPerRecord = -1
 		var req []tax.TaxFromCSV
+		var rejected []taxUsecases.RowError
 
-		if _, err := reader.Read(); err != nil {
+		record, err := reader.Read()
+		if err != nil {
 			if err == io.EOF {
 				return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "empty file")
 			}
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "could not read file")
 		}
 
+		line, _ := reader.FieldPos(0)
+		header, headerErrors, err := m.parseTaxCSVHeader(line, record)
+		if err != nil {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
+		}
+		if len(headerErrors) > 0 {
+			return taxUsecases.NewResponse(c).ResponseRowErrors(http.StatusBadRequest, "invalid csv header", headerErrors)
+		}
+
 		for {
 			record, err := reader.Read()
 			if err == io.EOF {
 				break
 			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rejected = append(rejected, taxUsecases.RowError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
 			if err != nil {
 				return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "could not read file")
 			}
 
-			totalIncome, err := strconv.ParseFloat(record[0], 64)
-			if err != nil {
-				return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "could not parse total income")
+			line, _ := reader.FieldPos(0)
+			row, rowErrors := m.parseTaxCSVRecord(header, line, record)
+			if len(rowErrors) > 0 {
+				rejected = append(rejected, rowErrors...)
+				continue
 			}
 
-			wht, err := strconv.ParseFloat(record[1], 64)
-			if err != nil {
-				return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "could not parse total wht")
+			req = append(req, row)
+		}
+
+		c.Set("mode", mode)
+		c.Set("columns", header.columns)
+		c.Set("rejected", rejected)
+		c.Set("request", req)
+		return next(c)
+	}
+}
+
+func (m *middlewareHandler) parseTaxCSVHeader(line int, record []string) (taxCSVHeader, []taxUsecases.RowError, error) {
+	header := taxCSVHeader{
+		columns:     make([]string, len(record)),
+		totalIncome: -1,
+		wht:         -1,
+		reference:   -1,
+		allowances:  make(map[int]string),
+	}
+
+	var allowanceTypes map[string]tax.TaxAllowanceType
+	var headerErrors []taxUsecases.RowError
+	seen := make(map[string]bool)
+	for i, cell := range record {
+		column := strings.TrimSpace(cell)
+		header.columns[i] = column
+		if seen[strings.ToLower(column)] {
+			headerErrors = append(headerErrors, taxUsecases.RowError{Line: line, Column: column, Message: fmt.Sprintf("duplicate column %s", column)})
+			continue
+		}
+		seen[strings.ToLower(column)] = true
+
+		switch {
+		case strings.EqualFold(column, tax.CSVColumnTotalIncome):
+			header.totalIncome = i
+		case strings.EqualFold(column, tax.CSVColumnWht):
+			header.wht = i
+		case strings.EqualFold(column, tax.CSVColumnReference):
+			header.reference = i
+		default:
+			if allowanceTypes == nil {
+				result, err := m.taxUsecase.ListAllowanceTypes()
+				if err != nil {
+					return taxCSVHeader{}, nil, err
+				}
+
+				allowanceTypes = make(map[string]tax.TaxAllowanceType, len(result))
+				for _, allowanceType := range result {
+					allowanceTypes[strings.ToLower(allowanceType.AllowanceType)] = allowanceType
+				}
 			}
 
-			donation, err := strconv.ParseFloat(record[2], 64)
-			if err != nil {
-				return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "could not parse donation")
+			allowanceType, ok := allowanceTypes[strings.ToLower(column)]
+			if !ok {
+				headerErrors = append(headerErrors, taxUsecases.RowError{Line: line, Column: column, Message: fmt.Sprintf("unknown column %s", column)})
+				continue
+			}
+			// an allowance that is disabled in the tax year of a row is rejected with the other fields of that row
+			if !allowanceType.IsUserSupplied() {
+				headerErrors = append(headerErrors, taxUsecases.RowError{Line: line, Column: column, Message: fmt.Sprintf("%s allowance can't be supplied", column)})
+				continue
 			}
 
-			req = append(req, tax.TaxFromCSV{
-				TotalIncome: totalIncome,
-				Wht:         wht,
-				Donation:    donation,
-			})
+			header.allowances[i] = allowanceType.AllowanceType
 		}
+	}
 
-		c.Set("request", req)
-		return next(c)
+	if header.totalIncome < 0 {
+		headerErrors = append(headerErrors, taxUsecases.RowError{Line: line, Column: tax.CSVColumnTotalIncome, Message: fmt.Sprintf("missing column %s", tax.CSVColumnTotalIncome)})
+	}
+	if header.wht < 0 {
+		headerErrors = append(headerErrors, taxUsecases.RowError{Line: line, Column: tax.CSVColumnWht, Message: fmt.Sprintf("missing column %s", tax.CSVColumnWht)})
+	}
+
+	return header, headerErrors, nil
+}
+
+// parseTaxCSVRecord parses every cell of the record so that all the problems of the row are reported together,
+// an empty allowance cell means the allowance is not claimed.
+func (m *middlewareHandler) parseTaxCSVRecord(header taxCSVHeader, line int, record []string) (tax.TaxFromCSV, []taxUsecases.RowError) {
+	if len(record) != len(header.columns) {
+		return tax.TaxFromCSV{}, []taxUsecases.RowError{
+			{Line: line, Message: fmt.Sprintf("expected %d columns but got %d", len(header.columns), len(record))},
+		}
+	}
+
+	row := tax.TaxFromCSV{Line: line}
+	var rowErrors []taxUsecases.RowError
+	for i, cell := range record {
+		cell = strings.TrimSpace(cell)
+		if i == header.reference {
+			row.Reference = cell
+			continue
+		}
+
+		allowanceType, isAllowance := header.allowances[i]
+		if isAllowance && cell == "" {
+			continue
+		}
+
+		value, err := csvinput.ParseAmount(cell)
+		if err != nil {
+			rowErrors = append(rowErrors, taxUsecases.RowError{Line: line, Column: header.columns[i], Message: fmt.Sprintf("could not parse %s: %q is not a number", header.columns[i], cell)})
+			continue
+		}
+
+		switch {
+		case i == header.totalIncome:
+			row.TotalIncome = value
+		case i == header.wht:
+			row.Wht = value
+		case isAllowance:
+			row.Allowances = append(row.Allowances, tax.AllowanceFromCSV{AllowanceType: allowanceType, Amount: value})
+		}
 	}
+
+	return row, rowErrors
 }
 
 func (m *middlewareHandler) ChangeStructFormat(next echo.HandlerFunc) echo.HandlerFunc {
@@ -196,12 +633,17 @@ func (m *middlewareHandler) ChangeStructFormat(next echo.HandlerFunc) echo.Handl
 
 		var result []taxUsecases.CalculateTaxRequest
 		for _, taxData := range req {
+			allowances := make([]taxUsecases.TaxAllowanceDetails, 0, len(taxData.Allowances))
+			for _, allowance := range taxData.Allowances {
+				allowances = append(allowances, taxUsecases.TaxAllowanceDetails{AllowanceType: allowance.AllowanceType, Amount: allowance.Amount})
+			}
+
 			calculateTaxRequest := taxUsecases.CalculateTaxRequest{
+				Line:        taxData.Line,
+				Reference:   taxData.Reference,
 				TotalIncome: taxData.TotalIncome,
 				Wht:         taxData.Wht,
-				Allowances: []taxUsecases.TaxAllowanceDetails{
-					{AllowanceType: "donation", Amount: taxData.Donation},
-				},
+				Allowances:  allowances,
 			}
 
 			result = append(result, calculateTaxRequest)
@@ -212,6 +654,8 @@ func (m *middlewareHandler) ChangeStructFormat(next echo.HandlerFunc) echo.Handl
 	}
 }
 
+// ValidateTaxFromCSV rejects the whole file when any row is invalid, in partial mode only the valid rows are passed on.
+// Every problem of a row is reported with the column that it belongs to.
 func (m *middlewareHandler) ValidateTaxFromCSV(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		req, ok := c.Get("request").([]taxUsecases.CalculateTaxRequest)
@@ -219,13 +663,27 @@ func (m *middlewareHandler) ValidateTaxFromCSV(next echo.HandlerFunc) echo.Handl
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
 		}
 
-		for _, taxData := range req {
-			if err := m.validateCalculateTaxRequest(&taxData); err != nil {
-				return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+		rejected, _ := c.Get("rejected").([]taxUsecases.RowError)
+		valid := make([]taxUsecases.CalculateTaxRequest, 0, len(req))
+		for i := range req {
+			if rowErrors := m.taxUsecase.ValidateCalculateTaxRequestFields(&req[i]); len(rowErrors) > 0 {
+				rejected = append(rejected, rowErrors...)
+				continue
 			}
+
+			valid = append(valid, req[i])
 		}
 
-		c.Set("request", req)
+		sort.SliceStable(rejected, func(i, j int) bool {
+			return rejected[i].Line < rejected[j].Line
+		})
+
+		if len(rejected) > 0 && c.Get("mode") != tax.CSVModePartial {
+			return taxUsecases.NewResponse(c).ResponseRowErrors(http.StatusBadRequest, "csv has invalid rows", rejected)
+		}
+
+		c.Set("rejected", rejected)
+		c.Set("request", valid)
 		return next(c)
 	}
 }
@@ -1,15 +1,235 @@
 package middlewareHandlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/Montheankul-K/assessment-tax/modules/admin"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
+	"github.com/Montheankul-K/assessment-tax/packages/money"
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/text/encoding/charmap"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
+type MockTaxUsecase struct {
+	mock.Mock
+}
+
+func (m *MockTaxUsecase) ResolveTaxYear(taxYear int) (int, error) {
+	args := m.Called(taxYear)
+	return args.Get(0).(int), args.Error(1)
+}
+
+func (m *MockTaxUsecase) FindBaseline(allowanceType string, rule tax.RuleFilter) (decimal.Decimal, decimal.Decimal, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).(decimal.Decimal), args.Error(2)
+}
+
+func (m *MockTaxUsecase) FindAllowance(allowanceType string, rule tax.RuleFilter) (*tax.TaxAllowance, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(*tax.TaxAllowance), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateTaxByTaxLevel(income decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, []taxUsecases.EachTaxLevel, error) {
+	args := m.Called(income, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel), args.Error(2)
+}
+
+func (m *MockTaxUsecase) WalkTaxLevels(income decimal.Decimal, taxLevels []taxUsecases.EachTaxLevel) (decimal.Decimal, []taxUsecases.EachTaxLevel) {
+	args := m.Called(income, taxLevels)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel)
+}
+
+func (m *MockTaxUsecase) GetTaxLevel(rule tax.RuleFilter) ([]taxUsecases.EachTaxLevel, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]taxUsecases.EachTaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListTaxLevels(rule tax.RuleFilter) ([]tax.TaxLevel, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateTaxLevel(req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	args := m.Called(req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) UpdateTaxLevel(id uint, req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	args := m.Called(id, req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DeleteTaxLevel(id uint, effectiveFrom time.Time) ([]tax.TaxLevel, error) {
+	args := m.Called(id, effectiveFrom)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
+	args := m.Called(req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ValidateTaxLevels(taxLevels []tax.TaxLevel) error {
+	args := m.Called(taxLevels)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	args := m.Called(req)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListTaxExpenses(rule tax.RuleFilter) ([]tax.TaxExpense, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateExpense(income decimal.Decimal, incomeType string, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(income, incomeType, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetMinimumTax(rule tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateMinimumTax(incomes []taxUsecases.TaxIncomeResponse, taxCredit decimal.Decimal, rule tax.RuleFilter) (*decimal.Decimal, error) {
+	args := m.Called(incomes, taxCredit, rule)
+	return args.Get(0).(*decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetDependentRule(rule tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	args := m.Called(allowanceType)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	args := m.Called()
+	return args.Get(0).([]tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DisableAllowanceType(req *tax.DisableAllowance) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAutomaticAllowances(totalIncome decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(totalIncome, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DecreaseWHT(tax, wht, taxCredit decimal.Decimal) decimal.Decimal {
+	args := m.Called(tax, wht, taxCredit)
+	return args.Get(0).(decimal.Decimal)
+}
+
+func (m *MockTaxUsecase) ValidateAllowance(allowance taxUsecases.TaxAllowanceDetails, rule tax.RuleFilter) error {
+	args := m.Called(allowance, rule)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAllowance(income decimal.Decimal, req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, []taxUsecases.TaxAllowanceDeduction, error) {
+	args := m.Called(income, req)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.TaxAllowanceDeduction), args.Error(2)
+}
+
+func (m *MockTaxUsecase) ConstructTaxLevels(taxLevels []tax.TaxLevel) []taxUsecases.EachTaxLevel {
+	args := m.Called(taxLevels)
+	return args.Get(0).([]taxUsecases.EachTaxLevel)
+}
+
+func (m *MockTaxUsecase) SetValueToTaxLevel(taxLevels []taxUsecases.EachTaxLevel) []taxUsecases.TaxLevelResponse {
+	args := m.Called(taxLevels)
+	return args.Get(0).([]taxUsecases.TaxLevelResponse)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequest(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequestFields(req *taxUsecases.CalculateTaxRequest) []taxUsecases.RowError {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.RowError)
+}
+
+func (m *MockTaxUsecase) ValidateDependents(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DependentAllowances(req *taxUsecases.CalculateTaxRequest) ([]taxUsecases.TaxAllowanceDetails, error) {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.TaxAllowanceDetails), args.Error(1)
+}
+
+func (m *MockTaxUsecase) IncomeExemption(req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, error) {
+	args := m.Called(req)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateTaxWithoutWHT(req *taxUsecases.CalculateTaxRequest) (*taxUsecases.TaxResult, error) {
+	args := m.Called(req)
+	return args.Get(0).(*taxUsecases.TaxResult), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateBulkTax(req *taxUsecases.CalculateTaxRequest, source string) (taxUsecases.TaxCalculationRecord, error) {
+	args := m.Called(req, source)
+	return args.Get(0).(taxUsecases.TaxCalculationRecord), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SaveTaxCalculations(records []taxUsecases.TaxCalculationRecord) ([]tax.TaxCalculation, error) {
+	args := m.Called(records)
+	return args.Get(0).([]tax.TaxCalculation), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetTaxCalculation(id uint) (*taxUsecases.TaxCalculationResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*taxUsecases.TaxCalculationResponse), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListTaxCalculations(req *taxUsecases.TaxCalculationFilter) (*taxUsecases.TaxCalculationListResponse, error) {
+	args := m.Called(req)
+	return args.Get(0).(*taxUsecases.TaxCalculationListResponse), args.Error(1)
+}
+
 func setupEchoContext() (ctx echo.Context, recorder *httptest.ResponseRecorder) {
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -20,14 +240,16 @@ func setupEchoContext() (ctx echo.Context, recorder *httptest.ResponseRecorder)
 
 func TestMiddlewareHandler_ValidateCalculateTaxRequest(t *testing.T) {
 	c, _ := setupEchoContext()
-	handler := &middlewareHandler{}
+	handler := &middlewareHandler{
+		taxUsecase: taxUsecases.TaxUsecase(nil, money.NewRounding(money.RoundHalfUp)),
+	}
 
 	req := &taxUsecases.CalculateTaxRequest{
-		TotalIncome: 500000,
-		Wht:         50000,
+		TotalIncome: decimal.NewFromInt(500000),
+		Wht:         decimal.NewFromInt(50000),
 		Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 10000},
-			{AllowanceType: "k-receipt", Amount: 20000},
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(10000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(20000)},
 		},
 	}
 
@@ -40,14 +262,249 @@ func TestMiddlewareHandler_ValidateCalculateTaxRequest(t *testing.T) {
 	assert.NotNil(t, c.Get("request"))
 }
 
+func TestMiddlewareHandler_ValidateCalculateTaxRequest_Dependents(t *testing.T) {
+	e := echo.New()
+	body := `{"totalIncome":500000,"wht":0,"dependents":{"spouse":{"hasIncome":true},"children":[{"birthDate":"2017-06-01T00:00:00Z"}]}}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	usecase := new(MockTaxUsecase)
+	handler := &middlewareHandler{taxUsecase: usecase}
+	usecase.On("ValidateCalculateTaxRequest", mock.Anything).Return(nil).Once()
+	usecase.On("ValidateDependents", mock.MatchedBy(func(req *taxUsecases.CalculateTaxRequest) bool {
+		return req.Dependents != nil && req.Dependents.Spouse.HasIncome && len(req.Dependents.Children) == 1
+	})).Return(errors.New("spouse allowance is only for a spouse without income")).Once()
+
+	err := handler.ValidateCalculateTaxRequest(func(c echo.Context) error {
+		t.Fatal("next handler must not be called")
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	usecase.AssertExpectations(t)
+}
+
+func setupCSVContext(t *testing.T, mode, content string) (ctx echo.Context, recorder *httptest.ResponseRecorder) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	if mode != "" {
+		assert.NoError(t, writer.WriteField("mode", mode))
+	}
+
+	part, err := writer.CreateFormFile("taxes", "taxes.csv")
+	assert.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+
+	return e.NewContext(req, rec), rec
+}
+
+func mockAllowanceTypes() []tax.TaxAllowanceType {
+	return []tax.TaxAllowanceType{
+		{AllowanceType: "personal", Source: tax.AllowanceSourceAutomatic},
+		{AllowanceType: "donation", Source: tax.AllowanceSourceUser},
+		{AllowanceType: "k-receipt", Source: tax.AllowanceSourceUser},
+		{AllowanceType: "elderly", Source: tax.AllowanceSourceTaxpayer},
+	}
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV(t *testing.T) {
+	content := "totalIncome,wht,donation\n500000,0,0\nabc,0,xyz\n600000,40000\n750000,50000,15000\n"
+	c, _ := setupCSVContext(t, tax.CSVModePartial, content)
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, tax.CSVModePartial, c.Get("mode"))
+
+	req := c.Get("request").([]tax.TaxFromCSV)
+	assert.Len(t, req, 2)
+	assert.Equal(t, 2, req[0].Line)
+	assert.Equal(t, 5, req[1].Line)
+
+	rejected := c.Get("rejected").([]taxUsecases.RowError)
+	assert.Len(t, rejected, 3)
+	assert.Equal(t, taxUsecases.RowError{Line: 3, Column: "totalIncome", Message: `could not parse totalIncome: "abc" is not a number`}, rejected[0])
+	assert.Equal(t, 3, rejected[1].Line)
+	assert.Equal(t, "donation", rejected[1].Column)
+	assert.Equal(t, 4, rejected[2].Line)
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_Header(t *testing.T) {
+	content := "reference,k-receipt,wht,donation,totalIncome\nEMP-001,,0,100000,500000\nEMP-002,30000,40000,,600000\n"
+	c, _ := setupCSVContext(t, "", content)
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, []tax.TaxFromCSV{
+		{Line: 2, Reference: "EMP-001", TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(0), Allowances: []tax.AllowanceFromCSV{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(100000)},
+		}},
+		{Line: 3, Reference: "EMP-002", TotalIncome: decimal.NewFromInt(600000), Wht: decimal.NewFromInt(40000), Allowances: []tax.AllowanceFromCSV{
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(30000)},
+		}},
+	}, c.Get("request"))
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_HeaderCase(t *testing.T) {
+	content := "TotalIncome,WHT,K-Receipt,Donation,DONATION\n500000,0,30000,100000,\n"
+	c, _ := setupCSVContext(t, "", content)
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Nil(t, c.Get("request"))
+
+	rec := c.Response().Writer.(*httptest.ResponseRecorder)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duplicate column DONATION")
+	assert.NotContains(t, rec.Body.String(), "unknown column")
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_AllowanceHeaderCase(t *testing.T) {
+	content := "TotalIncome,WHT,K-Receipt,Donation\n500000,0,30000,100000\n"
+	c, _ := setupCSVContext(t, "", content)
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, []tax.TaxFromCSV{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(0), Allowances: []tax.AllowanceFromCSV{
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(30000)},
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(100000)},
+		}},
+	}, c.Get("request"))
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_ThaiEncoding(t *testing.T) {
+	content, err := charmap.Windows874.NewEncoder().String("reference;totalIncome;wht;donation\r\nสมชาย;1,500,000.00;\"12.500,50\";฿ 2,000\r\n")
+	assert.NoError(t, err)
+
+	c, _ := setupCSVContext(t, "", content)
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err = handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	req := c.Get("request").([]tax.TaxFromCSV)
+	assert.Len(t, req, 1)
+	assert.Equal(t, "สมชาย", req[0].Reference)
+	assert.Equal(t, "1500000", req[0].TotalIncome.String())
+	assert.Equal(t, "12500.5", req[0].Wht.String())
+	assert.Equal(t, "2000", req[0].Allowances[0].Amount.String())
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_BOM(t *testing.T) {
+	c, _ := setupCSVContext(t, "", "\ufefftotalIncome\twht\n500000\t0\n")
+	handler := &middlewareHandler{}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"totalIncome", "wht"}, c.Get("columns"))
+	assert.Len(t, c.Get("request"), 1)
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_InvalidHeader(t *testing.T) {
+	c, rec := setupCSVContext(t, "", "wht,personal,elderly,bonus,wht\n0,0,0,0,0\n")
+	usecase := new(MockTaxUsecase)
+	usecase.On("ListAllowanceTypes").Return(mockAllowanceTypes(), nil).Once()
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var result taxUsecases.Error
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, []string{"personal", "elderly", "bonus", "wht", "totalIncome"}, func() []string {
+		var columns []string
+		for _, rowError := range result.Errors {
+			columns = append(columns, rowError.Column)
+		}
+		return columns
+	}())
+}
+
+func TestMiddlewareHandler_GetDataFromTaxCSV_InvalidMode(t *testing.T) {
+	c, rec := setupCSVContext(t, "lenient", "totalIncome,wht,donation\n500000,0,0\n")
+	handler := &middlewareHandler{}
+
+	err := handler.GetDataFromTaxCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 func TestMiddlewareHandler_ChangeStructFormat(t *testing.T) {
 	c, _ := setupEchoContext()
 	handler := &middlewareHandler{}
 
 	req := []tax.TaxFromCSV{
-		{TotalIncome: 500000, Wht: 0, Donation: 0},
-		{TotalIncome: 600000, Wht: 40000, Donation: 20000},
-		{TotalIncome: 750000, Wht: 50000, Donation: 15000},
+		{TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero},
+		{TotalIncome: decimal.NewFromInt(600000), Wht: decimal.NewFromInt(40000), Allowances: []tax.AllowanceFromCSV{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(20000)},
+		}},
+		{Reference: "EMP-003", TotalIncome: decimal.NewFromInt(750000), Wht: decimal.NewFromInt(50000), Allowances: []tax.AllowanceFromCSV{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(15000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(30000)},
+		}},
 	}
 
 	c.Set("request", req)
@@ -59,6 +516,12 @@ func TestMiddlewareHandler_ChangeStructFormat(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Len(t, result, len(req))
+	assert.Empty(t, result[0].Allowances)
+	assert.Equal(t, "EMP-003", result[2].Reference)
+	assert.Equal(t, []taxUsecases.TaxAllowanceDetails{
+		{AllowanceType: "donation", Amount: decimal.NewFromInt(15000)},
+		{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(30000)},
+	}, result[2].Allowances)
 }
 
 func TestMiddlewareHandler_ValidateTaxFromCSV(t *testing.T) {
@@ -66,14 +529,14 @@ func TestMiddlewareHandler_ValidateTaxFromCSV(t *testing.T) {
 	handler := &middlewareHandler{}
 
 	req := &[]taxUsecases.CalculateTaxRequest{
-		{TotalIncome: 500000, Wht: 0, Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 0},
+		{TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero, Allowances: []taxUsecases.TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.Zero},
 		}},
-		{TotalIncome: 600000, Wht: 40000, Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 20000},
+		{TotalIncome: decimal.NewFromInt(600000), Wht: decimal.NewFromInt(40000), Allowances: []taxUsecases.TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(20000)},
 		}},
-		{TotalIncome: 750000, Wht: 50000, Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 15000},
+		{TotalIncome: decimal.NewFromInt(750000), Wht: decimal.NewFromInt(50000), Allowances: []taxUsecases.TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(15000)},
 		}},
 	}
 
@@ -85,3 +548,287 @@ func TestMiddlewareHandler_ValidateTaxFromCSV(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, c.Get("request"))
 }
+
+func TestMiddlewareHandler_ValidateTaxFromCSV_RowErrors(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxUsecase)
+	handler := &middlewareHandler{
+		taxUsecase: usecase,
+	}
+
+	usecase.On("ValidateCalculateTaxRequestFields", mock.MatchedBy(func(req *taxUsecases.CalculateTaxRequest) bool {
+		return req.Line == 2
+	})).Return([]taxUsecases.RowError(nil)).Once()
+	usecase.On("ValidateCalculateTaxRequestFields", mock.MatchedBy(func(req *taxUsecases.CalculateTaxRequest) bool {
+		return req.Line == 3
+	})).Return([]taxUsecases.RowError{
+		{Line: 3, Column: tax.CSVColumnWht, Message: "wht must be between 0 and total income"},
+		{Line: 3, Column: "donation", Message: "donation amount must be at least 0"},
+	}).Once()
+
+	c.Set("request", []taxUsecases.CalculateTaxRequest{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000)},
+		{Line: 3, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(600000)},
+	})
+	err := handler.ValidateTaxFromCSV(func(c echo.Context) error {
+		return nil
+	})(c)
+
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `{"line":3,"column":"wht","message":"wht must be between 0 and total income"}`)
+	assert.Contains(t, rec.Body.String(), `{"line":3,"column":"donation","message":"donation amount must be at least 0"}`)
+}
+
+func TestMiddlewareHandler_ValidateSetDeductionRequest(t *testing.T) {
+	testCases := []struct {
+		name          string
+		allowanceType string
+		body          string
+		expectedCode  int
+	}{
+		{name: "income exemption over 100000", allowanceType: tax.AllowanceTypeIncomeExemption, body: `{"amount":190000}`, expectedCode: http.StatusOK},
+		{name: "provident fund", allowanceType: "provident-fund", body: `{"amount":500000}`, expectedCode: http.StatusOK},
+		{name: "negative amount", allowanceType: "ssf", body: `{"amount":-1}`, expectedCode: http.StatusBadRequest},
+		{name: "personal bounds are checked by the allowance", allowanceType: tax.AllowanceTypePersonal, body: `{"amount":100001}`, expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("allowanceType")
+			c.SetParamValues(tc.allowanceType)
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateSetDeductionRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateTaxLevelRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "valid tax level", body: `{"minIncome":0,"maxIncome":150000,"taxPercent":0}`, expectedCode: http.StatusOK},
+		{name: "percent over 100", body: `{"minIncome":0,"taxPercent":101}`, expectedCode: http.StatusBadRequest},
+		{name: "max income not greater than min income", body: `{"minIncome":150000,"maxIncome":150000,"taxPercent":10}`, expectedCode: http.StatusBadRequest},
+		{name: "effective from in the future", body: `{"minIncome":0,"taxPercent":0,"effectiveFrom":"2999-01-01T00:00:00Z"}`, expectedCode: http.StatusOK},
+		{name: "effective from in the past", body: `{"minIncome":0,"taxPercent":0,"effectiveFrom":"2024-01-01T00:00:00Z"}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("3")
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateTaxLevelRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode == http.StatusOK {
+				result := c.Get("request").(*admin.TaxLevelRequest)
+				assert.Equal(t, uint(3), result.ID)
+				assert.False(t, result.EffectiveFrom.IsZero())
+			}
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateDeleteTaxLevelRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		id           string
+		query        string
+		expectedCode int
+	}{
+		{name: "id without body", id: "3", expectedCode: http.StatusOK},
+		{name: "effective from in the query", id: "3", query: "?effectiveFrom=2999-01-01T00:00:00Z", expectedCode: http.StatusOK},
+		{name: "invalid id", id: "abc", expectedCode: http.StatusBadRequest},
+		{name: "effective from in the past", id: "3", query: "?effectiveFrom=2024-01-01T00:00:00Z", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(tc.id)
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateDeleteTaxLevelRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode == http.StatusOK {
+				result := c.Get("request").(*admin.DeleteTaxLevelRequest)
+				assert.Equal(t, uint(3), result.ID)
+				assert.False(t, result.EffectiveFrom.IsZero())
+			}
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateDisableAllowanceTypeRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		query        string
+		expectedCode int
+	}{
+		{name: "without query", expectedCode: http.StatusOK},
+		{name: "tax year and effective from in the query", query: "?taxYear=2567&effectiveFrom=2999-01-01T00:00:00Z", expectedCode: http.StatusOK},
+		{name: "invalid tax year", query: "?taxYear=abc", expectedCode: http.StatusBadRequest},
+		{name: "effective from in the past", query: "?effectiveFrom=2024-01-01T00:00:00Z", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("allowanceType")
+			c.SetParamValues("k-receipt")
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateDisableAllowanceTypeRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode == http.StatusOK {
+				result := c.Get("request").(*admin.DisableAllowanceTypeRequest)
+				assert.Equal(t, "k-receipt", result.AllowanceType)
+				assert.False(t, result.EffectiveFrom.IsZero())
+			}
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateDependentRuleRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "valid dependent rule", body: `{"maxParents":4,"minParentAge":60,"maxChildAge":20,"maxStudentAge":25,"laterChildBornFrom":"2018-01-01T00:00:00+07:00","maxDependentIncome":30000}`, expectedCode: http.StatusOK},
+		{name: "student age below child age", body: `{"maxParents":4,"minParentAge":60,"maxChildAge":20,"maxStudentAge":18,"laterChildBornFrom":"2018-01-01T00:00:00+07:00","maxDependentIncome":30000}`, expectedCode: http.StatusBadRequest},
+		{name: "missing later child date", body: `{"maxParents":4,"minParentAge":60,"maxChildAge":20,"maxStudentAge":25,"maxDependentIncome":30000}`, expectedCode: http.StatusBadRequest},
+		{name: "negative dependent income", body: `{"maxParents":4,"minParentAge":60,"maxChildAge":20,"maxStudentAge":25,"laterChildBornFrom":"2018-01-01T00:00:00+07:00","maxDependentIncome":-1}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateDependentRuleRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateTaxExpenseRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		incomeType   string
+		body         string
+		expectedCode int
+	}{
+		{name: "valid expense", body: `{"expensePercent":50,"maxAmount":100000}`, expectedCode: http.StatusOK},
+		{name: "income type sharing the expense of salary", incomeType: tax.IncomeTypeFreelance, body: `{"expensePercent":50}`, expectedCode: http.StatusBadRequest},
+		{name: "percent over 100", body: `{"expensePercent":101}`, expectedCode: http.StatusBadRequest},
+		{name: "negative max amount", body: `{"expensePercent":50,"maxAmount":-1}`, expectedCode: http.StatusBadRequest},
+		{name: "effective from in the past", body: `{"expensePercent":50,"effectiveFrom":"2024-01-01T00:00:00Z"}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("incomeType")
+			c.SetParamValues(tax.IncomeTypeSalary)
+			if tc.incomeType != "" {
+				c.SetParamValues(tc.incomeType)
+			}
+
+			handler := &middlewareHandler{}
+			err := handler.ValidateTaxExpenseRequest(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode == http.StatusOK {
+				result := c.Get("request").(*admin.TaxExpense)
+				assert.Equal(t, tax.IncomeTypeSalary, result.IncomeType)
+				assert.False(t, result.EffectiveFrom.IsZero())
+			}
+		})
+	}
+}
+
+func TestMiddlewareHandler_ValidateAllowanceTypeRequest(t *testing.T) {
+	handler := &middlewareHandler{}
+	adminMinAmount := decimal.NewFromInt(1000)
+
+	testCases := []struct {
+		name        string
+		req         admin.AllowanceTypeRequest
+		expectedErr bool
+	}{
+		{name: "valid allowance type", req: admin.AllowanceTypeRequest{AllowanceType: "life-insurance", DisplayName: "เบี้ยประกันชีวิต", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap, MaxAmount: decimal.NewFromInt(100000)}},
+		{name: "missing display name", req: admin.AllowanceTypeRequest{AllowanceType: "life-insurance", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationRange}, expectedErr: true},
+		{name: "unknown source", req: admin.AllowanceTypeRequest{AllowanceType: "life-insurance", DisplayName: "เบี้ยประกันชีวิต", Source: "system", ValidationMethod: tax.AllowanceValidationRange}, expectedErr: true},
+		{name: "min amount over max amount", req: admin.AllowanceTypeRequest{AllowanceType: "life-insurance", DisplayName: "เบี้ยประกันชีวิต", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationRange, MinAmount: decimal.NewFromInt(10), MaxAmount: decimal.NewFromInt(5)}, expectedErr: true},
+		{name: "admin max amount not over admin min amount", req: admin.AllowanceTypeRequest{AllowanceType: "life-insurance", DisplayName: "เบี้ยประกันชีวิต", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationRange, MaxAmount: decimal.NewFromInt(5), AdminMinAmount: &adminMinAmount, AdminMaxAmount: &adminMinAmount}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := handler.validateAllowanceTypeRequest(&tc.req)
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
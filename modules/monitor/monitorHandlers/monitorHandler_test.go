@@ -13,11 +13,13 @@ type MockConfig struct {
 	mockAppConfig *MockAppConfig
 	mockDBConfig  *MockDBConfig
 	mockAdminAuth *MockAdminAuth
+	mockTaxConfig *MockTaxConfig
 }
 
 type MockAppConfig struct{}
 type MockDBConfig struct{}
 type MockAdminAuth struct{}
+type MockTaxConfig struct{}
 
 func (m *MockConfig) App() config.IAppConfig {
 	return m.mockAppConfig
@@ -31,6 +33,10 @@ func (m *MockConfig) AdminAuth() config.IAdminAuth {
 	return m.mockAdminAuth
 }
 
+func (m *MockConfig) Tax() config.ITaxConfig {
+	return m.mockTaxConfig
+}
+
 func (m *MockAppConfig) Name() string {
 	return "name"
 }
@@ -55,6 +61,14 @@ func (m *MockAdminAuth) Password() string {
 	return "password"
 }
 
+func (m *MockTaxConfig) RoundingMode() string {
+	return "half-up"
+}
+
+func (m *MockTaxConfig) JobWorkers() int {
+	return 1
+}
+
 func setupEchoContext() (ctx echo.Context, recorder *httptest.ResponseRecorder) {
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -9,6 +9,7 @@ import (
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"log"
 )
 
 type IModule interface {
@@ -33,7 +34,7 @@ func NewModule(router *echo.Echo, server *server, middleware middlewareHandlers.
 
 func NewMiddleware(s *server) middlewareHandlers.IMiddlewareHandler {
 	repository := taxRepositories.TaxRepository(s.db)
-	usecase := taxUsecases.TaxUsecase(repository)
+	usecase := taxUsecases.TaxUsecase(repository, s.rounding)
 
 	return middlewareHandlers.MiddlewareHandler(s.config, usecase)
 }
@@ -56,23 +57,49 @@ func (m *moduleFactory) HealthCheckModule() {
 }
 
 func (m *moduleFactory) TaxModule() {
+	auth := m.server.config.AdminAuth()
+
 	repository := taxRepositories.TaxRepository(m.server.db)
-	usecase := taxUsecases.TaxUsecase(repository)
+	usecase := taxUsecases.TaxUsecase(repository, m.server.rounding)
 	handler := taxHandlers.TaxHandler(m.server.config, usecase)
+	jobUsecase := taxUsecases.TaxJobUsecase(repository, usecase, m.server.jobs)
+	if err := jobUsecase.FailUnfinishedTaxJobs(); err != nil {
+		log.Println(err)
+	}
+	jobHandler := taxHandlers.TaxJobHandler(m.server.config, jobUsecase)
 
 	router := m.router.Group("/tax")
 	router.POST("/calculations", m.middleware.ValidateCalculateTaxRequest(handler.CalculateTax))
+	router.POST("/calculations/stream", handler.CalculateTaxStream)
 	router.POST("/calculations/upload-csv", handler.CalculateTaxFromCSV, m.middleware.GetDataFromTaxCSV, m.middleware.ChangeStructFormat, m.middleware.ValidateTaxFromCSV)
+	router.GET("/calculations", m.middleware.ValidateTaxCalculationFilter(handler.GetTaxCalculations), m.basicAuthMiddleware(auth.Username(), auth.Password()))
+	router.GET("/calculations/:id", handler.GetTaxCalculation, m.basicAuthMiddleware(auth.Username(), auth.Password()))
+	router.POST("/jobs", jobHandler.SubmitTaxJob, m.basicAuthMiddleware(auth.Username(), auth.Password()), m.middleware.GetDataFromTaxCSV, m.middleware.ChangeStructFormat, m.middleware.ValidateTaxFromCSV)
+	router.GET("/jobs/:id", jobHandler.GetTaxJob, m.basicAuthMiddleware(auth.Username(), auth.Password()))
+	router.GET("/jobs/:id/result", jobHandler.GetTaxJobResult, m.basicAuthMiddleware(auth.Username(), auth.Password()))
 }
 
 func (m *moduleFactory) AdminModule() {
 	auth := m.server.config.AdminAuth()
 
 	repository := taxRepositories.TaxRepository(m.server.db)
-	usecase := taxUsecases.TaxUsecase(repository)
+	usecase := taxUsecases.TaxUsecase(repository, m.server.rounding)
 	handler := adminHandlers.AdminHandler(m.server.config, usecase)
 
 	router := m.router.Group("/admin", m.basicAuthMiddleware(auth.Username(), auth.Password()))
-	router.POST("/deductions/personal", m.middleware.ValidateSetDeductionRequest(handler.SetPersonalDeduction))
-	router.POST("/deductions/k-receipt", m.middleware.ValidateSetDeductionRequest(handler.SetKReceiptDeduction))
+	router.POST("/deductions/:allowanceType", m.middleware.ValidateSetDeductionRequest(handler.SetDeduction))
+	router.GET("/allowances", m.middleware.ValidateRuleFilter(handler.GetAllowanceTypes))
+	router.POST("/allowances", m.middleware.ValidateAllowanceTypeRequest(handler.CreateAllowanceType))
+	router.DELETE("/allowances/:allowanceType", m.middleware.ValidateDisableAllowanceTypeRequest(handler.DisableAllowanceType))
+	router.GET("/tax-levels", m.middleware.ValidateRuleFilter(handler.GetTaxLevels))
+	router.POST("/tax-levels", m.middleware.ValidateTaxLevelRequest(handler.CreateTaxLevel))
+	router.PUT("/tax-levels", m.middleware.ValidateSetTaxLevelsRequest(handler.SetTaxLevels))
+	router.PUT("/tax-levels/:id", m.middleware.ValidateTaxLevelRequest(handler.UpdateTaxLevel))
+	router.DELETE("/tax-levels/:id", m.middleware.ValidateDeleteTaxLevelRequest(handler.DeleteTaxLevel))
+	router.GET("/expenses", m.middleware.ValidateRuleFilter(handler.GetTaxExpenses))
+	router.POST("/expenses/:incomeType", m.middleware.ValidateTaxExpenseRequest(handler.SetTaxExpense))
+	router.GET("/minimum-tax", m.middleware.ValidateRuleFilter(handler.GetMinimumTax))
+	router.POST("/minimum-tax", m.middleware.ValidateMinimumTaxRequest(handler.SetMinimumTax))
+	router.GET("/dependent-rule", m.middleware.ValidateRuleFilter(handler.GetDependentRule))
+	router.POST("/dependent-rule", m.middleware.ValidateDependentRuleRequest(handler.SetDependentRule))
 }
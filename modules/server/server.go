@@ -3,6 +3,8 @@ package server
 import (
 	"context"
 	"github.com/Montheankul-K/assessment-tax/config"
+	"github.com/Montheankul-K/assessment-tax/packages/money"
+	"github.com/Montheankul-K/assessment-tax/packages/worker"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"gorm.io/gorm"
@@ -19,16 +21,20 @@ type IServer interface {
 }
 
 type server struct {
-	app    *echo.Echo
-	config config.IConfig
-	db     *gorm.DB
+	app      *echo.Echo
+	config   config.IConfig
+	db       *gorm.DB
+	rounding money.IRounding
+	jobs     worker.IPool
 }
 
 func NewServer(config config.IConfig, db *gorm.DB) IServer {
 	return &server{
-		app:    echo.New(),
-		config: config,
-		db:     db,
+		app:      echo.New(),
+		config:   config,
+		db:       db,
+		rounding: money.NewRounding(config.Tax().RoundingMode()),
+		jobs:     worker.NewPool(config.Tax().JobWorkers()),
 	}
 }
 func (s *server) GetServer() *server {
@@ -79,4 +85,8 @@ func (s *server) gracefulShutdown() {
 	if err := s.app.Shutdown(ctx); err != nil {
 		log.Fatal("server shutdown error: ", err)
 	}
+
+	if err := s.jobs.Shutdown(ctx); err != nil {
+		log.Println("tax jobs shutdown error: ", err)
+	}
 }
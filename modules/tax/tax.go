@@ -1,44 +1,430 @@
 package tax
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	AllowanceSourceUser      = "user"
+	AllowanceSourceAutomatic = "automatic"
+	// AllowanceSourceDependents is an allowance that is derived from the dependents of the request.
+	AllowanceSourceDependents = "dependents"
+	// AllowanceSourceTaxpayer is an allowance that is derived from the taxpayer of the request.
+	AllowanceSourceTaxpayer = "taxpayer"
+
+	AllowanceTypePersonal          = "personal"
+	AllowanceTypeKReceipt          = "k-receipt"
+	AllowanceTypeSpouse            = "spouse"
+	AllowanceTypeChild             = "child"
+	AllowanceTypeLaterChild        = "later-child"
+	AllowanceTypeParent            = "parent"
+	AllowanceTypeDisabledDependent = "disabled-dependent"
+	// AllowanceTypeIncomeExemption is the income of the elderly and the disabled that is exempt from tax.
+	AllowanceTypeIncomeExemption = "income-exemption"
+
+	// AllowanceGroupInsurance and AllowanceGroupRetirement share one max amount between their allowance types.
+	AllowanceGroupInsurance  = "insurance"
+	AllowanceGroupRetirement = "retirement"
+	AllowanceGroupDonation   = "donation"
+
+	// IncomeTypeSalary is income under section 40(1) and IncomeTypeFreelance is income under section 40(2),
+	// they share the expense deduction of salary.
+	IncomeTypeSalary       = "salary"
+	IncomeTypeFreelance    = "freelance"
+	IncomeTypeCopyright    = "copyright"    // 40(3)
+	IncomeTypeInterest     = "interest"     // 40(4)(a)
+	IncomeTypeDividend     = "dividend"     // 40(4)(b)
+	IncomeTypeRental       = "rental"       // 40(5)
+	IncomeTypeProfessional = "professional" // 40(6)
+	IncomeTypeContract     = "contract"     // 40(7)
+	IncomeTypeBusiness     = "business"     // 40(8)
+
+	AllowanceValidationRange = "range"
+	AllowanceValidationCap   = "cap"
+	// AllowanceValidationDonation caps the amount like cap and multiplies it by the deduction multiplier of the allowance.
+	AllowanceValidationDonation = "donation"
+
+	CalculationSourceAPI = "api"
+	CalculationSourceCSV = "csv"
+	// CalculationSourceNDJSON is a calculation from the streaming endpoint.
+	CalculationSourceNDJSON = "ndjson"
+
+	TaxJobPending = "pending"
+	TaxJobRunning = "running"
+	TaxJobDone    = "done"
+	TaxJobFailed  = "failed"
+
+	BulkResultCalculated = "calculated"
+	BulkResultRejected   = "rejected"
+
+	CSVModeStrict  = "strict"
+	CSVModePartial = "partial"
+
+	CSVColumnTotalIncome = "totalIncome"
+	CSVColumnWht         = "wht"
+	CSVColumnReference   = "reference"
+
+	// TaxMethodBracket is the tax on the net income by the tax levels.
+	TaxMethodBracket = "bracket"
+	// TaxMethodMinimum is the tax on the gross income that is not salary, it is used when it is higher than the bracket tax.
+	TaxMethodMinimum = "minimum"
+)
+
+var IncomeTypes = []string{
+	IncomeTypeSalary,
+	IncomeTypeFreelance,
+	IncomeTypeCopyright,
+	IncomeTypeInterest,
+	IncomeTypeDividend,
+	IncomeTypeRental,
+	IncomeTypeProfessional,
+	IncomeTypeContract,
+	IncomeTypeBusiness,
+}
+
+var DependentAllowanceTypes = []string{
+	AllowanceTypeSpouse,
+	AllowanceTypeChild,
+	AllowanceTypeLaterChild,
+	AllowanceTypeParent,
+	AllowanceTypeDisabledDependent,
+}
+
+var (
+	ErrInvalidTaxLevels         = errors.New("invalid tax levels")
+	ErrTaxLevelNotFound         = errors.New("tax level not found")
+	ErrTaxLevelVersionExists    = errors.New("tax level version already exists")
+	ErrAllowanceTypeNotFound    = errors.New("allowance type not found")
+	ErrAllowanceTypeExists      = errors.New("allowance type already exists")
+	ErrAllowanceTypeUnavailable = errors.New("allowance type is not available")
+	ErrInvalidDeductionAmount   = errors.New("invalid deduction amount")
+	ErrTaxCalculationNotFound   = errors.New("tax calculation not found")
+	ErrTaxJobNotFound           = errors.New("tax job not found")
+	ErrTaxJobNotDone            = errors.New("tax job is not done")
+	ErrTaxJobEmpty              = errors.New("tax job must have at least one row")
+	ErrTaxExpenseNotFound       = errors.New("tax expense not found")
+	ErrAllowanceGroupNotFound   = errors.New("allowance group not found")
+	ErrMinimumTaxNotFound       = errors.New("minimum tax not found")
+	ErrDependentRuleNotFound    = errors.New("dependent rule not found")
+)
+
+// TaxAllowanceType describes an allowance, its amounts, group and whether it is enabled are kept per tax year in
+// TaxAllowance.
+type TaxAllowanceType struct {
+	gorm.Model
+	AllowanceType    string `gorm:"not null;uniqueIndex"`
+	DisplayName      string `gorm:"not null"`
+	Source           string `gorm:"not null;default:'user'"`
+	ValidationMethod string `gorm:"not null;default:'range'"`
+}
 
 type TaxAllowance struct {
 	gorm.Model
-	AllowanceType      string  `gorm:"not null"`
-	MinAllowanceAmount float64 `gorm:"not null"`
-	MaxAllowanceAmount float64 `gorm:"not null"`
+	TaxYear            int             `gorm:"not null;default:2567"`
+	EffectiveFrom      time.Time       `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	AllowanceType      string          `gorm:"not null"`
+	AllowanceGroup     string          `gorm:"not null;default:''"`
+	Enabled            bool            `gorm:"not null;default:true"`
+	MinAllowanceAmount decimal.Decimal `gorm:"type:decimal(10,2) not null"`
+	MaxAllowanceAmount decimal.Decimal `gorm:"type:decimal(10,2) not null"`
+	// MaxIncomePercent limits the allowance to a percent of the income of IncomeType, or of the total income when it is empty.
+	MaxIncomePercent *decimal.Decimal `gorm:"type:decimal(5,2)"`
+	IncomeType       string           `gorm:"not null;default:''"`
+	// DeductionMultiplier is how many times the amount counts for the donation rule, nil counts it once.
+	DeductionMultiplier *decimal.Decimal `gorm:"type:decimal(5,2)"`
+	// AdminMinAmount and AdminMaxAmount bound the max amount an admin can set, it must be greater than AdminMinAmount
+	// and not greater than AdminMaxAmount. A nil bound isn't checked.
+	AdminMinAmount *decimal.Decimal `gorm:"type:decimal(10,2)"`
+	AdminMaxAmount *decimal.Decimal `gorm:"type:decimal(10,2)"`
+}
+
+// TaxAllowanceGroup is the max amount that the allowance types of a group can deduct together.
+// A group with MaxNetIncomePercent is deducted after the other allowances and is limited to a percent of the income left.
+type TaxAllowanceGroup struct {
+	gorm.Model
+	TaxYear             int              `gorm:"not null;default:2567"`
+	EffectiveFrom       time.Time        `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	AllowanceGroup      string           `gorm:"not null"`
+	MaxAmount           *decimal.Decimal `gorm:"type:decimal(10,2)"`
+	MaxNetIncomePercent *decimal.Decimal `gorm:"type:decimal(5,2)"`
+}
+
+// TaxExpense is the expense deduction of an income type, ExpensePercent of the income up to MaxExpenseAmount.
+type TaxExpense struct {
+	gorm.Model
+	TaxYear          int              `gorm:"not null;default:2567"`
+	EffectiveFrom    time.Time        `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	IncomeType       string           `gorm:"not null"`
+	ExpensePercent   decimal.Decimal  `gorm:"type:decimal(10,2) not null"`
+	MaxExpenseAmount *decimal.Decimal `gorm:"type:decimal(10,2)"`
+}
+
+// TaxMinimumTax is the alternative tax of TaxPercent of the gross income that is not salary, it applies once that income
+// reaches MinIncome and is waived when it is not more than MaxExemptTax.
+type TaxMinimumTax struct {
+	gorm.Model
+	TaxYear       int             `gorm:"not null;default:2567"`
+	EffectiveFrom time.Time       `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	MinIncome     decimal.Decimal `gorm:"type:decimal(10,2) not null"`
+	TaxPercent    decimal.Decimal `gorm:"type:decimal(5,2) not null"`
+	MaxExemptTax  decimal.Decimal `gorm:"type:decimal(10,2) not null"`
+}
+
+// TaxDependentRule limits who can be claimed as a dependent, ages are at the end of the tax year. From the second child
+// on, a child born on or after LaterChildBornFrom is a later child.
+type TaxDependentRule struct {
+	gorm.Model
+	TaxYear            int             `gorm:"not null;default:2567"`
+	EffectiveFrom      time.Time       `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	MaxParents         int             `gorm:"not null"`
+	MinParentAge       int             `gorm:"not null"`
+	MaxChildAge        int             `gorm:"not null"`
+	MaxStudentAge      int             `gorm:"not null"`
+	LaterChildBornFrom time.Time       `gorm:"not null"`
+	MaxDependentIncome decimal.Decimal `gorm:"type:decimal(10,2) not null"`
 }
 
 type TaxLevel struct {
 	gorm.Model
-	MinIncome  float64 `gorm:"type:decimal(10,2) not null"`
-	MaxIncome  float64 `gorm:"type:decimal(10,2) not null"`
-	TaxPercent float64 `gorm:"type:decimal(10,2) not null"`
+	TaxYear       int              `gorm:"not null;default:2567"`
+	EffectiveFrom time.Time        `gorm:"not null;default:'1970-01-01 00:00:00+00'"`
+	MinIncome     decimal.Decimal  `gorm:"type:decimal(10,2) not null"`
+	MaxIncome     *decimal.Decimal `gorm:"type:decimal(10,2)"`
+	TaxPercent    decimal.Decimal  `gorm:"type:decimal(10,2) not null"`
+}
+
+// TaxCalculation keeps a calculation as it was returned, with the tax year, effective time and rounding mode
+// needed to reproduce it.
+type TaxCalculation struct {
+	gorm.Model
+	Source       string          `gorm:"not null;index"`
+	TaxYear      int             `gorm:"not null;index"`
+	EffectiveAt  time.Time       `gorm:"not null"`
+	RoundingMode string          `gorm:"not null"`
+	TotalIncome  decimal.Decimal `gorm:"type:decimal(15,2) not null"`
+	TotalTax     decimal.Decimal `gorm:"type:decimal(15,2) not null"`
+	TaxRefund    decimal.Decimal `gorm:"type:decimal(15,2) not null"`
+	Request      string          `gorm:"type:jsonb;not null"`
+	Response     string          `gorm:"type:jsonb;not null"`
+}
+
+// TaxJob tracks a csv upload that is calculated in the background, Result holds the rows once the job is done.
+type TaxJob struct {
+	gorm.Model
+	Status        string `gorm:"not null;default:'pending'"`
+	TotalRows     int    `gorm:"not null"`
+	ProcessedRows int    `gorm:"not null;default:0"`
+	Message       string
+	Result        *string `gorm:"type:jsonb"`
 }
 
 type TaxFromCSV struct {
-	TotalIncome float64
-	Wht         float64
-	Donation    float64
+	Line        int
+	Reference   string
+	TotalIncome decimal.Decimal
+	Wht         decimal.Decimal
+	Allowances  []AllowanceFromCSV
+}
+
+type AllowanceFromCSV struct {
+	AllowanceType string
+	Amount        decimal.Decimal
+}
+
+type RuleFilter struct {
+	TaxYear     int
+	EffectiveAt time.Time
 }
 
 type AllowanceFilter struct {
 	AllowanceType string
+	RuleFilter
 }
 
-type TaxLevelFilter struct {
-	Income float64
+type AllowanceGroupFilter struct {
+	AllowanceGroup string
+	RuleFilter
+}
+
+type ExpenseFilter struct {
+	IncomeType string
+	RuleFilter
 }
 
 type SetNewDeductionAmount struct {
-	AllowanceFilter
-	NewDeductionAmount float64
+	AllowanceType      string
+	TaxYear            int
+	EffectiveFrom      time.Time
+	NewDeductionAmount decimal.Decimal
+}
+
+type SetNewTaxExpense struct {
+	IncomeType       string
+	TaxYear          int
+	EffectiveFrom    time.Time
+	ExpensePercent   decimal.Decimal
+	MaxExpenseAmount *decimal.Decimal
+}
+
+type SetNewMinimumTax struct {
+	TaxYear       int
+	EffectiveFrom time.Time
+	MinIncome     decimal.Decimal
+	TaxPercent    decimal.Decimal
+	MaxExemptTax  decimal.Decimal
+}
+
+type SetNewDependentRule struct {
+	TaxYear            int
+	EffectiveFrom      time.Time
+	MaxParents         int
+	MinParentAge       int
+	MaxChildAge        int
+	MaxStudentAge      int
+	LaterChildBornFrom time.Time
+	MaxDependentIncome decimal.Decimal
+}
+
+type TaxCalculationFilter struct {
+	Source      string
+	TaxYear     int
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Offset      int
+	Limit       int
+}
+
+type SetNewAllowanceType struct {
+	AllowanceType       string
+	DisplayName         string
+	Source              string
+	ValidationMethod    string
+	TaxYear             int
+	EffectiveFrom       time.Time
+	AllowanceGroup      string
+	MinAllowanceAmount  decimal.Decimal
+	MaxAllowanceAmount  decimal.Decimal
+	MaxIncomePercent    *decimal.Decimal
+	IncomeType          string
+	DeductionMultiplier *decimal.Decimal
+	AdminMinAmount      *decimal.Decimal
+	AdminMaxAmount      *decimal.Decimal
+}
+
+// DisableAllowance is the allowance type that can't be used from EffectiveFrom of TaxYear.
+type DisableAllowance struct {
+	AllowanceType string
+	TaxYear       int
+	EffectiveFrom time.Time
+}
+
+type SetNewTaxLevel struct {
+	TaxYear       int
+	EffectiveFrom time.Time
+	MinIncome     decimal.Decimal
+	MaxIncome     *decimal.Decimal
+	TaxPercent    decimal.Decimal
+}
+
+type SetNewTaxLevels struct {
+	TaxYear       int
+	EffectiveFrom time.Time
+	TaxLevels     []TaxLevel
 }
 
 func (TaxAllowance) TableName() string {
 	return "tax_allowance"
 }
 
+// WithMaxAmount returns the allowance with a new max amount, a fixed allowance (min equals max) moves its min amount too.
+func (a TaxAllowance) WithMaxAmount(amount decimal.Decimal) (TaxAllowance, error) {
+	if a.AdminMinAmount != nil && amount.LessThanOrEqual(*a.AdminMinAmount) {
+		return a, fmt.Errorf("%w: %s amount must be greater than %s", ErrInvalidDeductionAmount, a.AllowanceType, a.AdminMinAmount)
+	}
+
+	if a.AdminMaxAmount != nil && amount.GreaterThan(*a.AdminMaxAmount) {
+		return a, fmt.Errorf("%w: %s amount must not be greater than %s", ErrInvalidDeductionAmount, a.AllowanceType, a.AdminMaxAmount)
+	}
+
+	if a.MinAllowanceAmount.Equal(a.MaxAllowanceAmount) {
+		a.MinAllowanceAmount = amount
+	} else if amount.LessThan(a.MinAllowanceAmount) {
+		return a, fmt.Errorf("%w: max amount %s of %s is less than its min amount %s", ErrInvalidDeductionAmount, amount, a.AllowanceType, a.MinAllowanceAmount)
+	}
+
+	a.MaxAllowanceAmount = amount
+	return a, nil
+}
+
+func (TaxCalculation) TableName() string {
+	return "tax_calculation"
+}
+
+func (TaxJob) TableName() string {
+	return "tax_job"
+}
+
+func (TaxAllowanceType) TableName() string {
+	return "tax_allowance_type"
+}
+
+func (t TaxAllowanceType) IsAutomatic() bool {
+	return t.Source == AllowanceSourceAutomatic
+}
+
+func (t TaxAllowanceType) IsUserSupplied() bool {
+	return t.Source == AllowanceSourceUser
+}
+
+// IsMinimumTaxIncome reports whether the income counts in the gross income of the minimum tax, that is every income but
+// salary under section 40(1).
+func IsMinimumTaxIncome(incomeType string) bool {
+	return incomeType != IncomeTypeSalary
+}
+
+// ExpenseIncomeType returns the income type whose expense deduction applies to the income type.
+func ExpenseIncomeType(incomeType string) string {
+	if incomeType == IncomeTypeFreelance {
+		return IncomeTypeSalary
+	}
+
+	return incomeType
+}
+
+func IsIncomeType(incomeType string) bool {
+	for _, t := range IncomeTypes {
+		if t == incomeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (TaxAllowanceGroup) TableName() string {
+	return "tax_allowance_group"
+}
+
+func (TaxExpense) TableName() string {
+	return "tax_expense"
+}
+
+func (TaxMinimumTax) TableName() string {
+	return "tax_minimum_tax"
+}
+
+func (TaxDependentRule) TableName() string {
+	return "tax_dependent_rule"
+}
+
 func (TaxLevel) TableName() string {
 	return "tax_level"
 }
+
+func (l TaxLevel) IsOpenEnded() bool {
+	return l.MaxIncome == nil
+}
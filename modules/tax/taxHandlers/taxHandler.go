@@ -1,18 +1,36 @@
 package taxHandlers
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Montheankul-K/assessment-tax/config"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
 	"github.com/labstack/echo/v4"
-	"math"
+	"github.com/shopspring/decimal"
 	"net/http"
+	"sort"
+	"strconv"
 )
 
 type ITaxHandler interface {
 	CalculateTax(c echo.Context) error
 	CalculateTaxFromCSV(c echo.Context) error
+	CalculateTaxStream(c echo.Context) error
+	GetTaxCalculation(c echo.Context) error
+	GetTaxCalculations(c echo.Context) error
 }
 
+const (
+	MIMEApplicationNDJSON = "application/x-ndjson"
+
+	ndjsonMaxLineSize = 1024 * 1024
+	ndjsonBatchSize   = 500
+)
+
 type taxHandler struct {
 	config     config.IConfig
 	taxUsecase taxUsecases.ITaxUsecase
@@ -36,30 +54,55 @@ func (h *taxHandler) CalculateTax(c echo.Context) error {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 	}
 
-	taxLevel, err := h.taxUsecase.GetTaxLevelDetails(result)
-	if err != nil {
-		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
-	}
+	taxLevel := h.taxUsecase.SetValueToTaxLevel(result.TaxLevels)
+	summaryTax := h.taxUsecase.DecreaseWHT(result.Tax, req.TotalWht(), result.TaxCredit)
 
-	summaryTax := h.taxUsecase.DecreaseWHT(result, req.Wht)
+	var exemption, taxCredit *decimal.Decimal
+	if result.Exemption.IsPositive() {
+		exemption = &result.Exemption
+	}
+	if result.TaxCredit.IsPositive() {
+		taxCredit = &result.TaxCredit
+	}
 
 	responseData := taxUsecases.TaxResponse{
-		Tax:      result,
-		TaxLevel: taxLevel,
+		Incomes:             result.Incomes,
+		Expense:             result.Expense,
+		Exemption:           exemption,
+		TaxCredit:           taxCredit,
+		DependentAllowances: result.DependentAllowances,
+		Allowances:          result.Allowances,
+		Tax:                 result.Tax,
+		TaxMethod:           result.Method,
+		BracketTax:          result.BracketTax,
+		MinimumTax:          result.MinimumTax,
+		TaxLevel:            taxLevel,
+		TotalTax:            summaryTax,
+	}
+
+	record := taxUsecases.TaxCalculationRecord{
+		Source:   tax.CalculationSourceAPI,
+		Request:  req,
+		Response: responseData,
 		TotalTax: summaryTax,
 	}
 
-	if summaryTax < 0 {
-		responseData.TotalTax = 0
-		responseDataWithRefund := taxUsecases.TaxResponseWithRefund{
+	if summaryTax.IsNegative() {
+		responseData.TotalTax = decimal.Zero
+		record.TotalTax, record.TaxRefund = decimal.Zero, summaryTax.Abs()
+		record.Response = taxUsecases.TaxResponseWithRefund{
 			TaxResponse: responseData,
-			TaxRefund:   math.Abs(summaryTax),
+			TaxRefund:   summaryTax.Abs(),
 		}
+	}
 
-		return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, responseDataWithRefund)
+	calculations, err := h.taxUsecase.SaveTaxCalculations([]taxUsecases.TaxCalculationRecord{record})
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 	}
 
-	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, responseData)
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/tax/calculations/%d", calculations[0].ID))
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, record.Response)
 }
 
 func (h *taxHandler) CalculateTaxFromCSV(c echo.Context) error {
@@ -68,31 +111,193 @@ func (h *taxHandler) CalculateTaxFromCSV(c echo.Context) error {
 		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
 	}
 
-	var responseData []interface{}
-	for _, taxData := range req {
-		result, err := h.taxUsecase.CalculateTaxWithoutWHT(&taxData)
+	format, err := taxUsecases.ExportFormat(c.QueryParam("format"), c.Request().Header.Get(echo.HeaderAccept))
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, err.Error())
+	}
+
+	columns, _ := c.Get("columns").([]string)
+	rejected, _ := c.Get("rejected").([]taxUsecases.RowError)
+	export := taxUsecases.TaxExport{Columns: columns, Rejected: rejected}
+
+	results := taxUsecases.NewRejectedTaxBulkResults(rejected)
+	records := make([]taxUsecases.TaxCalculationRecord, 0, len(req))
+	for i := range req {
+		record, err := h.taxUsecase.CalculateBulkTax(&req[i], tax.CalculationSourceCSV)
 		if err != nil {
 			return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 		}
 
-		result = h.taxUsecase.DecreaseWHT(result, taxData.Wht)
-		if result < 0 {
-			taxResponse := taxUsecases.TaxCSVResponseWithRefund{
-				TotalIncome: taxData.TotalIncome,
-				Tax:         0,
-				TaxRefund:   math.Abs(result),
+		result := record.BulkResult()
+		records = append(records, record)
+		results = append(results, result)
+		exportRow := taxUsecases.TaxExportRow{
+			Request:    record.Request,
+			Expense:    record.Expense,
+			Tax:        record.TotalTax,
+			TaxRefund:  record.TaxRefund,
+			TaxMethod:  result.TaxMethod,
+			MinimumTax: result.MinimumTax,
+			TaxLevels:  record.TaxLevels,
+		}
+		if result.BracketTax != nil {
+			exportRow.BracketTax = *result.BracketTax
+		}
+		export.Rows = append(export.Rows, exportRow)
+	}
+
+	if _, err := h.taxUsecase.SaveTaxCalculations(records); err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
+	}
+
+	switch format {
+	case taxUsecases.ExportFormatCSV:
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=taxes.csv")
+		c.Response().Header().Set(echo.HeaderContentType, taxUsecases.MIMETextCSV)
+		c.Response().WriteHeader(http.StatusOK)
+		return export.WriteCSV(c.Response())
+	case taxUsecases.ExportFormatXLSX:
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=taxes.xlsx")
+		c.Response().Header().Set(echo.HeaderContentType, taxUsecases.MIMEXLSX)
+		c.Response().WriteHeader(http.StatusOK)
+		return export.WriteXLSX(c.Response())
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Row < results[j].Row
+	})
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, taxUsecases.TaxBulkResponse{Taxes: results})
+}
+
+// CalculateTaxStream reads one request per line and writes each result as soon as it is calculated,
+// only a batch of records is kept in memory until it is saved to the history. When a batch can't be saved the stream
+// ends with an error that lists the lines of the batch, those results were written but are not in the history.
+func (h *taxHandler) CalculateTaxStream(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+	c.Response().WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Response())
+	write := func(data interface{}) error {
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+
+		c.Response().Flush()
+		return nil
+	}
+
+	records := make([]taxUsecases.TaxCalculationRecord, 0, ndjsonBatchSize)
+	lines := make([]int, 0, ndjsonBatchSize)
+	save := func() (bool, error) {
+		if len(records) == 0 {
+			return true, nil
+		}
+
+		_, err := h.taxUsecase.SaveTaxCalculations(records)
+		if err != nil {
+			unsaved := make([]taxUsecases.RowError, 0, len(lines))
+			for _, line := range lines {
+				unsaved = append(unsaved, taxUsecases.RowError{Line: line, Message: "not saved"})
 			}
 
-			responseData = append(responseData, taxResponse)
+			return false, write(taxUsecases.Error{Message: fmt.Sprintf("stream stopped: %v", err), Errors: unsaved})
+		}
+
+		records = records[:0]
+		lines = lines[:0]
+		return true, nil
+	}
+
+	scanner := bufio.NewScanner(c.Request().Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), ndjsonMaxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if err := c.Request().Context().Err(); err != nil {
+			_, err := save()
+			return err
 		}
 
-		taxResponse := taxUsecases.TaxCSVResponse{
-			TotalIncome: taxData.TotalIncome,
-			Tax:         result,
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
 		}
 
-		responseData = append(responseData, taxResponse)
+		record, err := h.calculateTaxLine(line, scanner.Bytes())
+		if err != nil {
+			if err := write(taxUsecases.NewRejectedTaxBulkResults([]taxUsecases.RowError{{Line: line, Message: err.Error()}})[0]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := write(record.BulkResult()); err != nil {
+			return err
+		}
+
+		records = append(records, record)
+		lines = append(lines, line)
+		if len(records) == ndjsonBatchSize {
+			if saved, err := save(); err != nil || !saved {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if err := write(taxUsecases.Error{Message: fmt.Sprintf("could not read request: %v", err)}); err != nil {
+			return err
+		}
+	}
+
+	_, err := save()
+	return err
+}
+
+func (h *taxHandler) calculateTaxLine(line int, data []byte) (taxUsecases.TaxCalculationRecord, error) {
+	req := taxUsecases.NewCalculateTaxRequest()
+	if err := json.Unmarshal(data, req); err != nil {
+		return taxUsecases.TaxCalculationRecord{}, fmt.Errorf("invalid json: %v", err)
+	}
+	req.Line = line
+
+	if err := h.taxUsecase.ValidateCalculateTaxRequest(req); err != nil {
+		return taxUsecases.TaxCalculationRecord{}, err
+	}
+
+	if err := h.taxUsecase.ValidateDependents(req); err != nil {
+		return taxUsecases.TaxCalculationRecord{}, err
+	}
+
+	return h.taxUsecase.CalculateBulkTax(req, tax.CalculationSourceNDJSON)
+}
+
+func (h *taxHandler) GetTaxCalculation(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "invalid tax calculation id")
+	}
+
+	result, err := h.taxUsecase.GetTaxCalculation(uint(id))
+	if err != nil {
+		if errors.Is(err, tax.ErrTaxCalculationNotFound) {
+			return taxUsecases.NewResponse(c).ResponseError(http.StatusNotFound, err.Error())
+		}
+
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
+}
+
+func (h *taxHandler) GetTaxCalculations(c echo.Context) error {
+	req, ok := c.Get("request").(*taxUsecases.TaxCalculationFilter)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	result, err := h.taxUsecase.ListTaxCalculations(req)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, err.Error())
 	}
 
-	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, responseData)
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
 }
@@ -2,26 +2,33 @@ package taxHandlers
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/Montheankul-K/assessment-tax/config"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 type MockConfig struct {
 	mockAppConfig *MockAppConfig
 	mockDBConfig  *MockDBConfig
 	mockAdminAuth *MockAdminAuth
+	mockTaxConfig *MockTaxConfig
 }
 
 type MockAppConfig struct{}
 type MockDBConfig struct{}
 type MockAdminAuth struct{}
+type MockTaxConfig struct{}
 
 func (m *MockConfig) App() config.IAppConfig {
 	return m.mockAppConfig
@@ -35,6 +42,10 @@ func (m *MockConfig) AdminAuth() config.IAdminAuth {
 	return m.mockAdminAuth
 }
 
+func (m *MockConfig) Tax() config.ITaxConfig {
+	return m.mockTaxConfig
+}
+
 func (m *MockAppConfig) Name() string {
 	return "name"
 }
@@ -59,73 +70,221 @@ func (m *MockAdminAuth) Password() string {
 	return "password"
 }
 
+func (m *MockTaxConfig) RoundingMode() string {
+	return "half-up"
+}
+
+func (m *MockTaxConfig) JobWorkers() int {
+	return 1
+}
+
 type MockTaxUsecase struct {
 	mock.Mock
 }
 
-func (m *MockTaxUsecase) FindBaseline(allowanceType string) (float64, float64, error) {
-	args := m.Called(allowanceType)
-	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+func (m *MockTaxUsecase) ResolveTaxYear(taxYear int) (int, error) {
+	args := m.Called(taxYear)
+	return args.Get(0).(int), args.Error(1)
 }
 
-func (m *MockTaxUsecase) FindTaxPercent(totalIncome float64) (float64, error) {
-	args := m.Called(totalIncome)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) FindBaseline(allowanceType string, rule tax.RuleFilter) (decimal.Decimal, decimal.Decimal, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).(decimal.Decimal), args.Error(2)
 }
 
-func (m *MockTaxUsecase) FindMaxIncomeAndPercent() (float64, float64, error) {
-	args := m.Called()
-	return args.Get(0).(float64), args.Get(1).(float64), args.Error(2)
+func (m *MockTaxUsecase) FindAllowance(allowanceType string, rule tax.RuleFilter) (*tax.TaxAllowance, error) {
+	args := m.Called(allowanceType, rule)
+	return args.Get(0).(*tax.TaxAllowance), args.Error(1)
 }
 
-func (m *MockTaxUsecase) CalculateTaxByTaxLevel(income float64) (float64, error) {
-	args := m.Called(income)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) CalculateTaxByTaxLevel(income decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, []taxUsecases.EachTaxLevel, error) {
+	args := m.Called(income, rule)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel), args.Error(2)
 }
 
-func (m *MockTaxUsecase) GetTaxLevel() ([]taxUsecases.EachTaxLevel, error) {
-	args := m.Called()
+func (m *MockTaxUsecase) WalkTaxLevels(income decimal.Decimal, taxLevels []taxUsecases.EachTaxLevel) (decimal.Decimal, []taxUsecases.EachTaxLevel) {
+	args := m.Called(income, taxLevels)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.EachTaxLevel)
+}
+
+func (m *MockTaxUsecase) GetTaxLevel(rule tax.RuleFilter) ([]taxUsecases.EachTaxLevel, error) {
+	args := m.Called(rule)
 	return args.Get(0).([]taxUsecases.EachTaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (float64, error) {
+func (m *MockTaxUsecase) ListTaxLevels(rule tax.RuleFilter) ([]tax.TaxLevel, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateTaxLevel(req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
 	args := m.Called(req)
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreasePersonalAllowance(totalIncome float64) (float64, error) {
-	args := m.Called(totalIncome)
-	return args.Get(0).(float64), args.Error(1)
+func (m *MockTaxUsecase) UpdateTaxLevel(id uint, req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	args := m.Called(id, req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreaseWHT(tax, wht float64) float64 {
-	args := m.Called(tax, wht)
-	return args.Get(0).(float64)
+func (m *MockTaxUsecase) DeleteTaxLevel(id uint, effectiveFrom time.Time) ([]tax.TaxLevel, error) {
+	args := m.Called(id, effectiveFrom)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
 }
 
-func (m *MockTaxUsecase) DecreaseAllowance(tax float64, allowances []taxUsecases.TaxAllowanceDetails) float64 {
-	args := m.Called(tax, allowances)
-	return args.Get(0).(float64)
+func (m *MockTaxUsecase) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
+	args := m.Called(req)
+	return args.Get(0).([]tax.TaxLevel), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ValidateTaxLevels(taxLevels []tax.TaxLevel) error {
+	args := m.Called(taxLevels)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	args := m.Called(req)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
 }
 
-func (m *MockTaxUsecase) ConstructTaxLevels(maxIncomeAmount float64, taxLevels []tax.TaxLevel) []taxUsecases.EachTaxLevel {
-	args := m.Called(maxIncomeAmount, taxLevels)
+func (m *MockTaxUsecase) ListTaxExpenses(rule tax.RuleFilter) ([]tax.TaxExpense, error) {
+	args := m.Called(rule)
+	return args.Get(0).([]tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxExpense), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateExpense(income decimal.Decimal, incomeType string, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(income, incomeType, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetMinimumTax(rule tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxMinimumTax), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateMinimumTax(incomes []taxUsecases.TaxIncomeResponse, taxCredit decimal.Decimal, rule tax.RuleFilter) (*decimal.Decimal, error) {
+	args := m.Called(incomes, taxCredit, rule)
+	return args.Get(0).(*decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) GetDependentRule(rule tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	args := m.Called(rule)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxDependentRule), args.Error(1)
+}
+
+func (m *MockTaxUsecase) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	args := m.Called(allowanceType)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) ListAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	args := m.Called()
+	return args.Get(0).([]tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	args := m.Called(req)
+	return args.Get(0).(*tax.TaxAllowanceType), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DisableAllowanceType(req *tax.DisableAllowance) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAutomaticAllowances(totalIncome decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, error) {
+	args := m.Called(totalIncome, rule)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) DecreaseWHT(tax, wht, taxCredit decimal.Decimal) decimal.Decimal {
+	args := m.Called(tax, wht, taxCredit)
+	return args.Get(0).(decimal.Decimal)
+}
+
+func (m *MockTaxUsecase) ValidateAllowance(allowance taxUsecases.TaxAllowanceDetails, rule tax.RuleFilter) error {
+	args := m.Called(allowance, rule)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DecreaseAllowance(income decimal.Decimal, req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, []taxUsecases.TaxAllowanceDeduction, error) {
+	args := m.Called(income, req)
+	return args.Get(0).(decimal.Decimal), args.Get(1).([]taxUsecases.TaxAllowanceDeduction), args.Error(2)
+}
+
+func (m *MockTaxUsecase) ConstructTaxLevels(taxLevels []tax.TaxLevel) []taxUsecases.EachTaxLevel {
+	args := m.Called(taxLevels)
 	return args.Get(0).([]taxUsecases.EachTaxLevel)
 }
 
-func (m *MockTaxUsecase) SetValueToTaxLevel(taxLevels []taxUsecases.EachTaxLevel, tax float64) ([]taxUsecases.TaxLevelResponse, error) {
-	args := m.Called(taxLevels, tax)
-	return args.Get(0).([]taxUsecases.TaxLevelResponse), args.Error(1)
+func (m *MockTaxUsecase) SetValueToTaxLevel(taxLevels []taxUsecases.EachTaxLevel) []taxUsecases.TaxLevelResponse {
+	args := m.Called(taxLevels)
+	return args.Get(0).([]taxUsecases.TaxLevelResponse)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequest(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) ValidateCalculateTaxRequestFields(req *taxUsecases.CalculateTaxRequest) []taxUsecases.RowError {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.RowError)
+}
+
+func (m *MockTaxUsecase) ValidateDependents(req *taxUsecases.CalculateTaxRequest) error {
+	args := m.Called(req)
+	return args.Error(0)
+}
+
+func (m *MockTaxUsecase) DependentAllowances(req *taxUsecases.CalculateTaxRequest) ([]taxUsecases.TaxAllowanceDetails, error) {
+	args := m.Called(req)
+	return args.Get(0).([]taxUsecases.TaxAllowanceDetails), args.Error(1)
+}
+
+func (m *MockTaxUsecase) IncomeExemption(req *taxUsecases.CalculateTaxRequest) (decimal.Decimal, error) {
+	args := m.Called(req)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateTaxWithoutWHT(req *taxUsecases.CalculateTaxRequest) (*taxUsecases.TaxResult, error) {
+	args := m.Called(req)
+	return args.Get(0).(*taxUsecases.TaxResult), args.Error(1)
+}
+
+func (m *MockTaxUsecase) CalculateBulkTax(req *taxUsecases.CalculateTaxRequest, source string) (taxUsecases.TaxCalculationRecord, error) {
+	args := m.Called(req, source)
+	return args.Get(0).(taxUsecases.TaxCalculationRecord), args.Error(1)
+}
+
+func (m *MockTaxUsecase) SaveTaxCalculations(records []taxUsecases.TaxCalculationRecord) ([]tax.TaxCalculation, error) {
+	args := m.Called(records)
+	return args.Get(0).([]tax.TaxCalculation), args.Error(1)
 }
 
-func (m *MockTaxUsecase) GetTaxLevelDetails(tax float64) ([]taxUsecases.TaxLevelResponse, error) {
-	args := m.Called(tax)
-	return args.Get(0).([]taxUsecases.TaxLevelResponse), args.Error(1)
+func (m *MockTaxUsecase) GetTaxCalculation(id uint) (*taxUsecases.TaxCalculationResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*taxUsecases.TaxCalculationResponse), args.Error(1)
 }
 
-func (m *MockTaxUsecase) CalculateTaxWithoutWHT(req *taxUsecases.CalculateTaxRequest) (float64, error) {
+func (m *MockTaxUsecase) ListTaxCalculations(req *taxUsecases.TaxCalculationFilter) (*taxUsecases.TaxCalculationListResponse, error) {
 	args := m.Called(req)
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).(*taxUsecases.TaxCalculationListResponse), args.Error(1)
 }
 
 func setupEchoContext() (ctx echo.Context, recorder *httptest.ResponseRecorder) {
@@ -143,39 +302,45 @@ func TestTaxHandler_CalculateTax_WithRefund(t *testing.T) {
 	}
 
 	req := &taxUsecases.CalculateTaxRequest{
-		TotalIncome: 500000.0,
-		Wht:         50000.0,
+		TotalIncome: decimal.NewFromInt(500000),
+		Wht:         decimal.NewFromInt(50000),
 		Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 10000.0},
-			{AllowanceType: "k-receipt", Amount: 20000.0},
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(10000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(20000)},
 		},
 	}
 	c.Set("request", req)
 
-	taxWithoutWHT := 40000.0
-	usecase.On("CalculateTaxWithoutWHT", req).Return(taxWithoutWHT, nil).Once()
-	usecase.On("GetTaxLevelDetails", taxWithoutWHT).Return([]taxUsecases.TaxLevelResponse{
+	taxWithoutWHT := decimal.NewFromInt(40000)
+	taxLevels := []taxUsecases.EachTaxLevel{
+		{Level: "0-150000", TaxPercent: decimal.Zero, Tax: decimal.Zero},
+		{Level: "150001-500000", TaxPercent: decimal.NewFromInt(10), Tax: taxWithoutWHT},
+	}
+	usecase.On("CalculateTaxWithoutWHT", req).Return(&taxUsecases.TaxResult{Tax: taxWithoutWHT, TaxLevels: taxLevels, Expense: decimal.NewFromInt(100000), TaxCredit: decimal.Zero}, nil).Once()
+	usecase.On("SetValueToTaxLevel", taxLevels).Return([]taxUsecases.TaxLevelResponse{
 		{Level: "0-150000", Tax: taxWithoutWHT},
-		{Level: "150001-500000", Tax: 0.0},
-		{Level: "500001-1000000", Tax: 0.0},
-		{Level: "1000001-2000000", Tax: 0.0},
-		{Level: "2000001 ขึ้นไป", Tax: 0.0},
-	}, nil).Once()
-	usecase.On("DecreaseWHT", taxWithoutWHT, req.Wht).Return(-10000.0)
+		{Level: "150001-500000", Tax: decimal.Zero},
+		{Level: "500001-1000000", Tax: decimal.Zero},
+		{Level: "1000001-2000000", Tax: decimal.Zero},
+		{Level: "2000001 ขึ้นไป", Tax: decimal.Zero},
+	}).Once()
+	usecase.On("DecreaseWHT", taxWithoutWHT, req.Wht, decimal.Zero).Return(decimal.NewFromInt(-10000))
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
 
 	expectResult := taxUsecases.TaxResponseWithRefund{
 		TaxResponse: taxUsecases.TaxResponse{
-			Tax: 40000.0,
+			Expense: decimal.NewFromInt(100000),
+			Tax:     decimal.NewFromInt(40000),
 			TaxLevel: []taxUsecases.TaxLevelResponse{
 				{Level: "0-150000", Tax: taxWithoutWHT},
-				{Level: "150001-500000", Tax: 0.0},
-				{Level: "500001-1000000", Tax: 0.0},
-				{Level: "1000001-2000000", Tax: 0.0},
-				{Level: "2000001 ขึ้นไป", Tax: 0.0},
+				{Level: "150001-500000", Tax: decimal.Zero},
+				{Level: "500001-1000000", Tax: decimal.Zero},
+				{Level: "1000001-2000000", Tax: decimal.Zero},
+				{Level: "2000001 ขึ้นไป", Tax: decimal.Zero},
 			},
-			TotalTax: 0.0,
+			TotalTax: decimal.Zero,
 		},
-		TaxRefund: 10000.0,
+		TaxRefund: decimal.NewFromInt(10000),
 	}
 
 	err := handler.CalculateTax(c)
@@ -183,15 +348,11 @@ func TestTaxHandler_CalculateTax_WithRefund(t *testing.T) {
 	usecase.AssertExpectations(t)
 
 	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.Equal(t, "/tax/calculations/1", rec.Header().Get(echo.HeaderLocation))
 
-	var responseData taxUsecases.TaxResponseWithRefund
-	err = json.NewDecoder(rec.Result().Body).Decode(&responseData)
+	expectBody, err := json.Marshal(expectResult)
 	assert.NoError(t, err)
-
-	assert.Equal(t, expectResult.Tax, responseData.TaxResponse.Tax)
-	assert.Equal(t, expectResult.TaxLevel, responseData.TaxResponse.TaxLevel)
-	assert.Equal(t, expectResult.TotalTax, responseData.TaxResponse.TotalTax)
-	assert.Equal(t, expectResult.TaxRefund, responseData.TaxRefund)
+	assert.JSONEq(t, string(expectBody), rec.Body.String())
 }
 
 func TestTaxHandler_CalculateTax_NoRefund(t *testing.T) {
@@ -202,49 +363,283 @@ func TestTaxHandler_CalculateTax_NoRefund(t *testing.T) {
 	}
 
 	req := &taxUsecases.CalculateTaxRequest{
-		TotalIncome: 500000.0,
-		Wht:         30000.0,
+		TotalIncome: decimal.NewFromInt(500000),
+		Wht:         decimal.NewFromInt(30000),
 		Allowances: []taxUsecases.TaxAllowanceDetails{
-			{AllowanceType: "donation", Amount: 10000.0},
-			{AllowanceType: "k-receipt", Amount: 20000.0},
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(10000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(20000)},
 		},
 	}
 	c.Set("request", req)
 
-	taxWithoutWHT := 40000.0
-	usecase.On("CalculateTaxWithoutWHT", req).Return(taxWithoutWHT, nil).Once()
-	usecase.On("GetTaxLevelDetails", taxWithoutWHT).Return([]taxUsecases.TaxLevelResponse{
+	taxWithoutWHT := decimal.NewFromInt(40000)
+	taxLevels := []taxUsecases.EachTaxLevel{
+		{Level: "0-150000", TaxPercent: decimal.Zero, Tax: decimal.Zero},
+		{Level: "150001-500000", TaxPercent: decimal.NewFromInt(10), Tax: taxWithoutWHT},
+	}
+	usecase.On("CalculateTaxWithoutWHT", req).Return(&taxUsecases.TaxResult{Tax: taxWithoutWHT, TaxLevels: taxLevels, Expense: decimal.NewFromInt(100000), TaxCredit: decimal.Zero}, nil).Once()
+	usecase.On("SetValueToTaxLevel", taxLevels).Return([]taxUsecases.TaxLevelResponse{
 		{Level: "0-150000", Tax: taxWithoutWHT},
-		{Level: "150001-500000", Tax: 0.0},
-		{Level: "500001-1000000", Tax: 0.0},
-		{Level: "1000001-2000000", Tax: 0.0},
-		{Level: "2000001 ขึ้นไป", Tax: 0.0},
-	}, nil).Once()
-	usecase.On("DecreaseWHT", taxWithoutWHT, req.Wht).Return(10000.0)
+		{Level: "150001-500000", Tax: decimal.Zero},
+		{Level: "500001-1000000", Tax: decimal.Zero},
+		{Level: "1000001-2000000", Tax: decimal.Zero},
+		{Level: "2000001 ขึ้นไป", Tax: decimal.Zero},
+	}).Once()
+	usecase.On("DecreaseWHT", taxWithoutWHT, req.Wht, decimal.Zero).Return(decimal.NewFromInt(10000))
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
 
 	expectResult := taxUsecases.TaxResponse{
-		Tax: 40000.0,
+		Expense: decimal.NewFromInt(100000),
+		Tax:     decimal.NewFromInt(40000),
 		TaxLevel: []taxUsecases.TaxLevelResponse{
 			{Level: "0-150000", Tax: taxWithoutWHT},
-			{Level: "150001-500000", Tax: 0.0},
-			{Level: "500001-1000000", Tax: 0.0},
-			{Level: "1000001-2000000", Tax: 0.0},
-			{Level: "2000001 ขึ้นไป", Tax: 0.0},
+			{Level: "150001-500000", Tax: decimal.Zero},
+			{Level: "500001-1000000", Tax: decimal.Zero},
+			{Level: "1000001-2000000", Tax: decimal.Zero},
+			{Level: "2000001 ขึ้นไป", Tax: decimal.Zero},
 		},
-		TotalTax: 10000.0,
+		TotalTax: decimal.NewFromInt(10000),
 	}
 
 	err := handler.CalculateTax(c)
 	assert.NoError(t, err)
 	usecase.AssertExpectations(t)
 
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.Equal(t, "/tax/calculations/1", rec.Header().Get(echo.HeaderLocation))
+
+	expectBody, err := json.Marshal(expectResult)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expectBody), rec.Body.String())
+}
+
+func mockBulkTaxRecord(req *taxUsecases.CalculateTaxRequest, totalTax, taxRefund int64, taxLevels []taxUsecases.TaxLevelResponse) taxUsecases.TaxCalculationRecord {
+	result := decimal.NewFromInt(totalTax)
+	refund := decimal.NewFromInt(taxRefund)
+	bracketTax := result.Add(req.Wht).Sub(refund)
+
+	return taxUsecases.TaxCalculationRecord{
+		Source:  tax.CalculationSourceCSV,
+		Request: req,
+		Response: taxUsecases.TaxBulkResult{
+			Row:        req.Line,
+			Status:     tax.BulkResultCalculated,
+			Input:      req,
+			TaxMethod:  tax.TaxMethodBracket,
+			BracketTax: &bracketTax,
+			Tax:        &result,
+			TaxRefund:  &refund,
+		},
+		TotalTax:  result,
+		TaxRefund: refund,
+		TaxLevels: taxLevels,
+	}
+}
+
+func TestTaxHandler_CalculateTaxFromCSV_Refund(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	req := []taxUsecases.CalculateTaxRequest{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(30000)},
+	}
+	c.Set("request", req)
+
+	usecase.On("CalculateBulkTax", &req[0], tax.CalculationSourceCSV).Return(mockBulkTaxRecord(&req[0], 0, 1000, nil), nil).Once()
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
+
+	err := handler.CalculateTaxFromCSV(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.JSONEq(t, `{"taxes":[{"row":2,"status":"calculated","input":{"taxYear":0,"effectiveAt":"0001-01-01T00:00:00Z","totalIncome":"500000","wht":"30000","allowances":null},"taxMethod":"bracket","bracketTax":"29000","tax":"0","taxRefund":"1000"}]}`, rec.Body.String())
+}
+
+func TestTaxHandler_CalculateTaxFromCSV_Partial(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	req := []taxUsecases.CalculateTaxRequest{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero},
+	}
+	rejected := []taxUsecases.RowError{
+		{Line: 3, Column: "wht", Message: "could not parse wht: \"abc\" is not a number"},
+	}
+	c.Set("mode", tax.CSVModePartial)
+	c.Set("rejected", rejected)
+	c.Set("request", req)
+
+	usecase.On("CalculateBulkTax", &req[0], tax.CalculationSourceCSV).Return(mockBulkTaxRecord(&req[0], 29000, 0, nil), nil).Once()
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
+
+	err := handler.CalculateTaxFromCSV(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
 	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
 
-	var responseData taxUsecases.TaxResponseWithRefund
-	err = json.NewDecoder(rec.Result().Body).Decode(&responseData)
+	var result taxUsecases.TaxBulkResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Len(t, result.Taxes, 2)
+	assert.Equal(t, tax.BulkResultCalculated, result.Taxes[0].Status)
+	assert.Equal(t, "29000", result.Taxes[0].Tax.String())
+	assert.Equal(t, taxUsecases.TaxBulkResult{Row: 3, Status: tax.BulkResultRejected, Errors: rejected}, result.Taxes[1])
+}
+
+func TestTaxHandler_CalculateTaxFromCSV_ExportCSV(t *testing.T) {
+	c, rec := setupEchoContext()
+	c.Request().Header.Set(echo.HeaderAccept, "text/csv")
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	req := []taxUsecases.CalculateTaxRequest{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(30000)},
+	}
+	c.Set("columns", []string{"totalIncome", "wht"})
+	c.Set("request", req)
+
+	usecase.On("CalculateBulkTax", &req[0], tax.CalculationSourceCSV).Return(mockBulkTaxRecord(&req[0], 0, 1000, []taxUsecases.TaxLevelResponse{
+		{Level: "0-150000", Tax: decimal.Zero},
+		{Level: "150001-500000", Tax: decimal.NewFromInt(29000)},
+	}), nil).Once()
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
+
+	err := handler.CalculateTaxFromCSV(c)
 	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.Equal(t, taxUsecases.MIMETextCSV, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "line,totalIncome,wht,expense,tax,taxRefund,taxMethod,bracketTax,minimumTax,tax 0-150000,tax 150001-500000\n2,500000,30000,0,0,1000,bracket,29000,,0,29000\n", rec.Body.String())
+}
+
+func TestTaxHandler_CalculateTaxFromCSV_InvalidFormat(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/?format=pdf", nil), rec)
+	handler := &taxHandler{}
 
-	assert.Equal(t, expectResult.Tax, responseData.Tax)
-	assert.Equal(t, expectResult.TaxLevel, responseData.TaxLevel)
-	assert.Equal(t, expectResult.TotalTax, responseData.TotalTax)
+	c.Set("request", []taxUsecases.CalculateTaxRequest{})
+
+	err := handler.CalculateTaxFromCSV(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+}
+
+func TestTaxHandler_CalculateTaxStream(t *testing.T) {
+	e := echo.New()
+	body := `{"totalIncome":500000,"wht":0,"reference":"EMP-001"}` + "\n\n" +
+		`{"totalIncome":` + "\n" +
+		`{"totalIncome":-1,"wht":0}` + "\n"
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), rec)
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	usecase.On("ValidateCalculateTaxRequest", mock.MatchedBy(func(req *taxUsecases.CalculateTaxRequest) bool {
+		return req.Line == 1
+	})).Return(nil).Once()
+	usecase.On("ValidateCalculateTaxRequest", mock.MatchedBy(func(req *taxUsecases.CalculateTaxRequest) bool {
+		return req.Line == 4
+	})).Return(errors.New("total income must be gather than zero")).Once()
+	usecase.On("ValidateDependents", mock.Anything).Return(nil).Once()
+	record := mockBulkTaxRecord(&taxUsecases.CalculateTaxRequest{Line: 1, Reference: "EMP-001", TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(0)}, 29000, 0, nil)
+	record.Source = tax.CalculationSourceNDJSON
+	usecase.On("CalculateBulkTax", mock.Anything, tax.CalculationSourceNDJSON).Return(record, nil).Once()
+	usecase.On("SaveTaxCalculations", mock.MatchedBy(func(records []taxUsecases.TaxCalculationRecord) bool {
+		return len(records) == 1 && records[0].Source == tax.CalculationSourceNDJSON
+	})).Return([]tax.TaxCalculation{{Model: gorm.Model{ID: 1}}}, nil).Once()
+
+	err := handler.CalculateTaxStream(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.Equal(t, MIMEApplicationNDJSON, rec.Header().Get(echo.HeaderContentType))
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.JSONEq(t, `{"row":1,"status":"calculated","input":{"taxYear":0,"effectiveAt":"0001-01-01T00:00:00Z","reference":"EMP-001","totalIncome":"500000","wht":"0","allowances":null},"taxMethod":"bracket","bracketTax":"29000","tax":"29000","taxRefund":"0"}`, lines[0])
+	assert.Contains(t, lines[1], `"row":3,"status":"rejected"`)
+	assert.JSONEq(t, `{"row":4,"status":"rejected","errors":[{"line":4,"message":"total income must be gather than zero"}]}`, lines[2])
+}
+
+func TestTaxHandler_CalculateTaxStream_SaveFailed(t *testing.T) {
+	e := echo.New()
+	var body strings.Builder
+	for i := 0; i < ndjsonBatchSize+1; i++ {
+		body.WriteString(`{"totalIncome":500000,"wht":0}` + "\n")
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body.String())), rec)
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	usecase.On("ValidateCalculateTaxRequest", mock.Anything).Return(nil)
+	usecase.On("ValidateDependents", mock.Anything).Return(nil)
+	usecase.On("CalculateBulkTax", mock.Anything, tax.CalculationSourceNDJSON).Return(mockBulkTaxRecord(&taxUsecases.CalculateTaxRequest{TotalIncome: decimal.NewFromInt(500000)}, 29000, 0, nil), nil)
+	usecase.On("SaveTaxCalculations", mock.Anything).Return([]tax.TaxCalculation(nil), errors.New("failed to save tax calculations")).Once()
+
+	err := handler.CalculateTaxStream(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	usecase.AssertNumberOfCalls(t, "CalculateBulkTax", ndjsonBatchSize)
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	assert.Len(t, lines, ndjsonBatchSize+1)
+	var result taxUsecases.Error
+	assert.NoError(t, json.Unmarshal([]byte(lines[ndjsonBatchSize]), &result))
+	assert.Contains(t, result.Message, "stream stopped")
+	assert.Len(t, result.Errors, ndjsonBatchSize)
+	assert.Equal(t, 1, result.Errors[0].Line)
+	assert.Equal(t, ndjsonBatchSize, result.Errors[ndjsonBatchSize-1].Line)
+}
+
+func TestTaxHandler_GetTaxCalculation_NotFound(t *testing.T) {
+	c, rec := setupEchoContext()
+	c.SetParamNames("id")
+	c.SetParamValues("9")
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	usecase.On("GetTaxCalculation", uint(9)).Return((*taxUsecases.TaxCalculationResponse)(nil), tax.ErrTaxCalculationNotFound).Once()
+
+	err := handler.GetTaxCalculation(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusNotFound, rec.Result().StatusCode)
+}
+
+func TestTaxHandler_GetTaxCalculations(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxUsecase)
+	handler := &taxHandler{
+		taxUsecase: usecase,
+	}
+
+	req := &taxUsecases.TaxCalculationFilter{Page: 1, PageSize: 20}
+	c.Set("request", req)
+
+	usecase.On("ListTaxCalculations", req).Return(&taxUsecases.TaxCalculationListResponse{
+		TaxCalculations: []taxUsecases.TaxCalculationResponse{},
+		Page:            1,
+		PageSize:        20,
+	}, nil).Once()
+
+	err := handler.GetTaxCalculations(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+	assert.JSONEq(t, `{"taxCalculations":[],"page":1,"pageSize":20,"total":0}`, rec.Body.String())
 }
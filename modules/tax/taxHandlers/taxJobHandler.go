@@ -0,0 +1,88 @@
+package taxHandlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/config"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type ITaxJobHandler interface {
+	SubmitTaxJob(c echo.Context) error
+	GetTaxJob(c echo.Context) error
+	GetTaxJobResult(c echo.Context) error
+}
+
+type taxJobHandler struct {
+	config        config.IConfig
+	taxJobUsecase taxUsecases.ITaxJobUsecase
+}
+
+func TaxJobHandler(config config.IConfig, taxJobUsecase taxUsecases.ITaxJobUsecase) ITaxJobHandler {
+	return &taxJobHandler{
+		config:        config,
+		taxJobUsecase: taxJobUsecase,
+	}
+}
+
+func (h *taxJobHandler) errorStatus(err error) int {
+	switch {
+	case errors.Is(err, tax.ErrTaxJobEmpty):
+		return http.StatusBadRequest
+	case errors.Is(err, tax.ErrTaxJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tax.ErrTaxJobNotDone):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *taxJobHandler) SubmitTaxJob(c echo.Context) error {
+	req, ok := c.Get("request").([]taxUsecases.CalculateTaxRequest)
+	if !ok {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusInternalServerError, "failed to get request from context")
+	}
+
+	rejected, _ := c.Get("rejected").([]taxUsecases.RowError)
+	result, err := h.taxJobUsecase.SubmitTaxJob(req, rejected)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/tax/jobs/%d", result.ID))
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusAccepted, result)
+}
+
+func (h *taxJobHandler) GetTaxJob(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "invalid tax job id")
+	}
+
+	result, err := h.taxJobUsecase.GetTaxJob(uint(id))
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	return taxUsecases.NewResponse(c).ResponseSuccess(http.StatusOK, result)
+}
+
+func (h *taxJobHandler) GetTaxJobResult(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(http.StatusBadRequest, "invalid tax job id")
+	}
+
+	result, err := h.taxJobUsecase.GetTaxJobResult(uint(id))
+	if err != nil {
+		return taxUsecases.NewResponse(c).ResponseError(h.errorStatus(err), err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=tax-job-%d.json", id))
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, result)
+}
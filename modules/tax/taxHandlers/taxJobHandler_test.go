@@ -0,0 +1,98 @@
+package taxHandlers
+
+import (
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/Montheankul-K/assessment-tax/modules/tax/taxUsecases"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"testing"
+)
+
+type MockTaxJobUsecase struct {
+	mock.Mock
+}
+
+func (m *MockTaxJobUsecase) SubmitTaxJob(reqs []taxUsecases.CalculateTaxRequest, rejected []taxUsecases.RowError) (*taxUsecases.TaxJobResponse, error) {
+	args := m.Called(reqs, rejected)
+	return args.Get(0).(*taxUsecases.TaxJobResponse), args.Error(1)
+}
+
+func (m *MockTaxJobUsecase) GetTaxJob(id uint) (*taxUsecases.TaxJobResponse, error) {
+	args := m.Called(id)
+	return args.Get(0).(*taxUsecases.TaxJobResponse), args.Error(1)
+}
+
+func (m *MockTaxJobUsecase) GetTaxJobResult(id uint) ([]byte, error) {
+	args := m.Called(id)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockTaxJobUsecase) FailUnfinishedTaxJobs() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func TestTaxJobHandler_SubmitTaxJob(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxJobUsecase)
+	handler := &taxJobHandler{
+		taxJobUsecase: usecase,
+	}
+
+	req := []taxUsecases.CalculateTaxRequest{
+		{TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero},
+	}
+	c.Set("request", req)
+
+	usecase.On("SubmitTaxJob", req, []taxUsecases.RowError(nil)).Return(&taxUsecases.TaxJobResponse{
+		ID:        7,
+		Status:    tax.TaxJobPending,
+		TotalRows: 1,
+	}, nil).Once()
+
+	err := handler.SubmitTaxJob(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusAccepted, rec.Result().StatusCode)
+	assert.Equal(t, "/tax/jobs/7", rec.Header().Get(echo.HeaderLocation))
+}
+
+func TestTaxJobHandler_SubmitTaxJob_Empty(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxJobUsecase)
+	handler := &taxJobHandler{
+		taxJobUsecase: usecase,
+	}
+
+	req := []taxUsecases.CalculateTaxRequest{}
+	c.Set("request", req)
+
+	usecase.On("SubmitTaxJob", req, []taxUsecases.RowError(nil)).Return((*taxUsecases.TaxJobResponse)(nil), tax.ErrTaxJobEmpty).Once()
+
+	err := handler.SubmitTaxJob(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadRequest, rec.Result().StatusCode)
+}
+
+func TestTaxJobHandler_GetTaxJobResult_NotDone(t *testing.T) {
+	c, rec := setupEchoContext()
+	usecase := new(MockTaxJobUsecase)
+	handler := &taxJobHandler{
+		taxJobUsecase: usecase,
+	}
+
+	c.SetParamNames("id")
+	c.SetParamValues("7")
+
+	usecase.On("GetTaxJobResult", uint(7)).Return([]byte(nil), fmt.Errorf("%w: 7 is running", tax.ErrTaxJobNotDone)).Once()
+
+	err := handler.GetTaxJobResult(c)
+	assert.NoError(t, err)
+	usecase.AssertExpectations(t)
+	assert.Equal(t, http.StatusConflict, rec.Result().StatusCode)
+}
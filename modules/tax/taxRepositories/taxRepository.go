@@ -4,15 +4,39 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"time"
 )
 
 type ITaxRepository interface {
-	FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (float64, float64, error)
-	FindTaxPercentByIncome(req *tax.TaxLevelFilter) (float64, error)
-	FindMaxIncomeAndPercent() (float64, float64, error)
-	GetTaxLevel() ([]tax.TaxLevel, error)
-	SetDeduction(req *tax.SetNewDeductionAmount) (float64, error)
+	FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (decimal.Decimal, decimal.Decimal, error)
+	FindAllowance(req *tax.AllowanceFilter) (*tax.TaxAllowance, error)
+	FindAllowanceGroup(req *tax.AllowanceGroupFilter) (*tax.TaxAllowanceGroup, error)
+	GetTaxLevel(req *tax.RuleFilter) ([]tax.TaxLevel, error)
+	FindTaxLevelByID(id uint) (*tax.TaxLevel, error)
+	SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error)
+	FindTaxYears() ([]int, error)
+	SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error)
+	FindTaxExpense(req *tax.ExpenseFilter) (*tax.TaxExpense, error)
+	FindTaxExpenses(req *tax.RuleFilter) ([]tax.TaxExpense, error)
+	SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error)
+	FindMinimumTax(req *tax.RuleFilter) (*tax.TaxMinimumTax, error)
+	SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error)
+	FindDependentRule(req *tax.RuleFilter) (*tax.TaxDependentRule, error)
+	SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error)
+	FindAllowanceTypes() ([]tax.TaxAllowanceType, error)
+	FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error)
+	CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error)
+	DisableAllowanceType(req *tax.DisableAllowance) error
+	CreateTaxCalculations(calculations []tax.TaxCalculation) ([]tax.TaxCalculation, error)
+	FindTaxCalculation(id uint) (*tax.TaxCalculation, error)
+	FindTaxCalculations(req *tax.TaxCalculationFilter) ([]tax.TaxCalculation, int64, error)
+	CreateTaxJob(totalRows int) (*tax.TaxJob, error)
+	FindTaxJob(id uint) (*tax.TaxJob, error)
+	SetTaxJobProgress(id uint, processedRows int) error
+	FinishTaxJob(id uint, status string, result *string, message string) error
+	FailUnfinishedTaxJobs(message string) (int64, error)
 }
 
 type taxRepository struct {
@@ -25,48 +49,58 @@ func TaxRepository(db *gorm.DB) ITaxRepository {
 	}
 }
 
-func (t *taxRepository) FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (float64, float64, error) {
+func (t *taxRepository) activeAllowance(db *gorm.DB, allowanceType string, req *tax.RuleFilter) *gorm.DB {
+	return db.Where("allowance_type = ? AND tax_year = ? AND effective_from <= ?", allowanceType, req.TaxYear, req.EffectiveAt).Order("effective_from DESC, id DESC")
+}
+
+// activeTaxLevels selects the tax levels of the latest version that is effective at req.EffectiveAt.
+func (t *taxRepository) activeTaxLevels(req *tax.RuleFilter) *gorm.DB {
+	version := t.db.Model(&tax.TaxLevel{}).Select("MAX(effective_from)").Where("tax_year = ? AND effective_from <= ?", req.TaxYear, req.EffectiveAt)
+	return t.db.Where("tax_year = ? AND effective_from = (?)", req.TaxYear, version)
+}
+
+func (t *taxRepository) FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (decimal.Decimal, decimal.Decimal, error) {
 	var taxAllowance tax.TaxAllowance
-	if result := t.db.Select("min_allowance_amount", "max_allowance_amount").Where("allowance_type = ?", req.AllowanceType).First(&taxAllowance); result.Error != nil {
+	if result := t.activeAllowance(t.db, req.AllowanceType, &req.RuleFilter).Select("min_allowance_amount", "max_allowance_amount").First(&taxAllowance); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return 0, 0, fmt.Errorf("baseline amount for %s not found", req.AllowanceType)
+			return decimal.Zero, decimal.Zero, fmt.Errorf("baseline amount for %s in %d not found", req.AllowanceType, req.TaxYear)
 		}
 
-		return 0, 0, fmt.Errorf("can't find baseline amount for %s", req.AllowanceType)
+		return decimal.Zero, decimal.Zero, fmt.Errorf("can't find baseline amount for %s in %d", req.AllowanceType, req.TaxYear)
 	}
 
 	return taxAllowance.MinAllowanceAmount, taxAllowance.MaxAllowanceAmount, nil
 }
 
-func (t *taxRepository) FindTaxPercentByIncome(req *tax.TaxLevelFilter) (float64, error) {
-	var taxLevel tax.TaxLevel
-	if result := t.db.Select("tax_percent").Where("min_income <= ? AND max_income >= ?", req.Income, req.Income).First(&taxLevel); result.Error != nil {
+func (t *taxRepository) FindAllowance(req *tax.AllowanceFilter) (*tax.TaxAllowance, error) {
+	var taxAllowance tax.TaxAllowance
+	if result := t.activeAllowance(t.db, req.AllowanceType, &req.RuleFilter).First(&taxAllowance); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return 0, fmt.Errorf("income for %.1f not found", req.Income)
+			return nil, fmt.Errorf("allowance for %s in %d not found", req.AllowanceType, req.TaxYear)
 		}
 
-		return 0, fmt.Errorf("can't find income for %.1f", req.Income)
+		return nil, fmt.Errorf("can't find allowance for %s in %d", req.AllowanceType, req.TaxYear)
 	}
 
-	return taxLevel.TaxPercent, nil
+	return &taxAllowance, nil
 }
 
-func (t *taxRepository) FindMaxIncomeAndPercent() (float64, float64, error) {
-	var taxLevel tax.TaxLevel
-	if result := t.db.Order("max_income DESC").Select("max_income, tax_percent").First(&taxLevel); result.Error != nil {
+func (t *taxRepository) FindAllowanceGroup(req *tax.AllowanceGroupFilter) (*tax.TaxAllowanceGroup, error) {
+	var allowanceGroup tax.TaxAllowanceGroup
+	if result := t.db.Where("allowance_group = ? AND tax_year = ? AND effective_from <= ?", req.AllowanceGroup, req.TaxYear, req.EffectiveAt).Order("effective_from DESC, id DESC").First(&allowanceGroup); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return 0, 0, fmt.Errorf("max income and max tax percent not found")
+			return nil, fmt.Errorf("%w: %s in %d", tax.ErrAllowanceGroupNotFound, req.AllowanceGroup, req.TaxYear)
 		}
 
-		return 0, 0, fmt.Errorf("can't find max income and max tax percent")
+		return nil, fmt.Errorf("can't find allowance group %s in %d", req.AllowanceGroup, req.TaxYear)
 	}
 
-	return taxLevel.MaxIncome, taxLevel.TaxPercent, nil
+	return &allowanceGroup, nil
 }
 
-func (t *taxRepository) GetTaxLevel() ([]tax.TaxLevel, error) {
+func (t *taxRepository) GetTaxLevel(req *tax.RuleFilter) ([]tax.TaxLevel, error) {
 	var taxLevels []tax.TaxLevel
-	if result := t.db.Find(&taxLevels); result.Error != nil {
+	if result := t.activeTaxLevels(req).Order("min_income ASC").Find(&taxLevels); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return taxLevels, fmt.Errorf("tax level not found")
 		}
@@ -77,33 +111,538 @@ func (t *taxRepository) GetTaxLevel() ([]tax.TaxLevel, error) {
 	return taxLevels, nil
 }
 
-func (t *taxRepository) SetDeduction(req *tax.SetNewDeductionAmount) (float64, error) {
+func (t *taxRepository) FindTaxLevelByID(id uint) (*tax.TaxLevel, error) {
+	var taxLevel tax.TaxLevel
+	if result := t.db.First(&taxLevel, id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", tax.ErrTaxLevelNotFound, id)
+		}
+
+		return nil, fmt.Errorf("can't find tax level %d", id)
+	}
+
+	return &taxLevel, nil
+}
+
+// SetTaxLevels adds the tax levels as a new version, a version is never replaced because saved calculations refer to it.
+func (t *taxRepository) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
 	txn := t.db.Begin()
 	if txn.Error != nil {
-		return 0, fmt.Errorf("can't begin transaction")
+		return nil, fmt.Errorf("can't begin transaction")
+	}
+
+	var count int64
+	if err := txn.Model(&tax.TaxLevel{}).Where("tax_year = ? AND effective_from = ?", req.TaxYear, req.EffectiveFrom).Count(&count).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't find tax level version")
+	}
+
+	if count > 0 {
+		txn.Rollback()
+		return nil, fmt.Errorf("%w: %d effective from %s", tax.ErrTaxLevelVersionExists, req.TaxYear, req.EffectiveFrom.Format(time.RFC3339))
+	}
+
+	if err := txn.Model(&tax.TaxLevel{}).Where("tax_year = ?", req.TaxYear).Count(&count).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't find tax levels of %d", req.TaxYear)
+	}
+
+	if count == 0 {
+		if err := t.copyTaxYearRules(txn, req.TaxYear, req.EffectiveFrom); err != nil {
+			txn.Rollback()
+			return nil, err
+		}
+	}
+
+	taxLevels := make([]tax.TaxLevel, 0, len(req.TaxLevels))
+	for _, level := range req.TaxLevels {
+		taxLevels = append(taxLevels, tax.TaxLevel{
+			TaxYear:       req.TaxYear,
+			EffectiveFrom: req.EffectiveFrom,
+			MinIncome:     level.MinIncome,
+			MaxIncome:     level.MaxIncome,
+			TaxPercent:    level.TaxPercent,
+		})
+	}
+
+	if err := txn.Create(&taxLevels).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't create tax level")
+	}
+
+	if err := txn.Commit().Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't commit transaction")
+	}
+
+	return taxLevels, nil
+}
+
+// taxYears selects the tax years that have tax levels, allowances, expenses and a dependent rule, a year without one of
+// them can't calculate a tax.
+func (t *taxRepository) taxYears(db *gorm.DB) *gorm.DB {
+	return db.Model(&tax.TaxLevel{}).
+		Where("tax_year IN (?)", db.Model(&tax.TaxAllowance{}).Select("tax_year")).
+		Where("tax_year IN (?)", db.Model(&tax.TaxExpense{}).Select("tax_year")).
+		Where("tax_year IN (?)", db.Model(&tax.TaxDependentRule{}).Select("tax_year"))
+}
+
+func (t *taxRepository) FindTaxYears() ([]int, error) {
+	var taxYears []int
+	if result := t.taxYears(t.db).Distinct("tax_year").Order("tax_year ASC").Pluck("tax_year", &taxYears); result.Error != nil {
+		return taxYears, fmt.Errorf("can't find tax years")
+	}
+
+	return taxYears, nil
+}
+
+// copyTaxYearRules starts a new tax year with the latest version of each rule of the previous complete tax year, the
+// copies take effect at effectiveFrom. A rule that the new tax year already has is not copied.
+func (t *taxRepository) copyTaxYearRules(txn *gorm.DB, taxYear int, effectiveFrom time.Time) error {
+	var previousTaxYears []int
+	if err := t.taxYears(txn).Where("tax_year < ?", taxYear).Distinct("tax_year").Order("tax_year DESC").Limit(1).Pluck("tax_year", &previousTaxYears).Error; err != nil {
+		return fmt.Errorf("can't find the tax year before %d", taxYear)
+	}
+
+	if len(previousTaxYears) == 0 {
+		return nil
+	}
+	previousTaxYear := previousTaxYears[0]
+
+	var allowances []tax.TaxAllowance
+	if err := txn.Select("DISTINCT ON (allowance_type) *").
+		Where("tax_year = ? AND allowance_type NOT IN (?)", previousTaxYear, txn.Model(&tax.TaxAllowance{}).Select("allowance_type").Where("tax_year = ?", taxYear)).
+		Order("allowance_type ASC, effective_from DESC, id DESC").Find(&allowances).Error; err != nil {
+		return fmt.Errorf("can't find tax allowances of %d", previousTaxYear)
+	}
+	for i := range allowances {
+		allowances[i].Model, allowances[i].TaxYear, allowances[i].EffectiveFrom = gorm.Model{}, taxYear, effectiveFrom
+	}
+	if len(allowances) > 0 {
+		if err := txn.Create(&allowances).Error; err != nil {
+			return fmt.Errorf("can't create tax allowances of %d", taxYear)
+		}
+	}
+
+	var allowanceGroups []tax.TaxAllowanceGroup
+	if err := txn.Select("DISTINCT ON (allowance_group) *").
+		Where("tax_year = ? AND allowance_group NOT IN (?)", previousTaxYear, txn.Model(&tax.TaxAllowanceGroup{}).Select("allowance_group").Where("tax_year = ?", taxYear)).
+		Order("allowance_group ASC, effective_from DESC, id DESC").Find(&allowanceGroups).Error; err != nil {
+		return fmt.Errorf("can't find allowance groups of %d", previousTaxYear)
+	}
+	for i := range allowanceGroups {
+		allowanceGroups[i].Model, allowanceGroups[i].TaxYear, allowanceGroups[i].EffectiveFrom = gorm.Model{}, taxYear, effectiveFrom
+	}
+	if len(allowanceGroups) > 0 {
+		if err := txn.Create(&allowanceGroups).Error; err != nil {
+			return fmt.Errorf("can't create allowance groups of %d", taxYear)
+		}
+	}
+
+	var taxExpenses []tax.TaxExpense
+	if err := txn.Select("DISTINCT ON (income_type) *").
+		Where("tax_year = ? AND income_type NOT IN (?)", previousTaxYear, txn.Model(&tax.TaxExpense{}).Select("income_type").Where("tax_year = ?", taxYear)).
+		Order("income_type ASC, effective_from DESC, id DESC").Find(&taxExpenses).Error; err != nil {
+		return fmt.Errorf("can't find tax expenses of %d", previousTaxYear)
+	}
+	for i := range taxExpenses {
+		taxExpenses[i].Model, taxExpenses[i].TaxYear, taxExpenses[i].EffectiveFrom = gorm.Model{}, taxYear, effectiveFrom
+	}
+	if len(taxExpenses) > 0 {
+		if err := txn.Create(&taxExpenses).Error; err != nil {
+			return fmt.Errorf("can't create tax expenses of %d", taxYear)
+		}
+	}
+
+	var minimumTaxes []tax.TaxMinimumTax
+	if err := txn.Where("tax_year = ? AND NOT EXISTS (?)", previousTaxYear, txn.Model(&tax.TaxMinimumTax{}).Select("1").Where("tax_year = ?", taxYear)).
+		Order("effective_from DESC, id DESC").Limit(1).Find(&minimumTaxes).Error; err != nil {
+		return fmt.Errorf("can't find minimum tax of %d", previousTaxYear)
+	}
+	for i := range minimumTaxes {
+		minimumTaxes[i].Model, minimumTaxes[i].TaxYear, minimumTaxes[i].EffectiveFrom = gorm.Model{}, taxYear, effectiveFrom
+	}
+	if len(minimumTaxes) > 0 {
+		if err := txn.Create(&minimumTaxes).Error; err != nil {
+			return fmt.Errorf("can't create minimum tax of %d", taxYear)
+		}
+	}
+
+	var dependentRules []tax.TaxDependentRule
+	if err := txn.Where("tax_year = ? AND NOT EXISTS (?)", previousTaxYear, txn.Model(&tax.TaxDependentRule{}).Select("1").Where("tax_year = ?", taxYear)).
+		Order("effective_from DESC, id DESC").Limit(1).Find(&dependentRules).Error; err != nil {
+		return fmt.Errorf("can't find dependent rule of %d", previousTaxYear)
+	}
+	for i := range dependentRules {
+		dependentRules[i].Model, dependentRules[i].TaxYear, dependentRules[i].EffectiveFrom = gorm.Model{}, taxYear, effectiveFrom
+	}
+	if len(dependentRules) > 0 {
+		if err := txn.Create(&dependentRules).Error; err != nil {
+			return fmt.Errorf("can't create dependent rule of %d", taxYear)
+		}
+	}
+
+	return nil
+}
+
+// SetDeduction keeps the previous allowance and adds a new version that takes effect at req.EffectiveFrom.
+func (t *taxRepository) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	txn := t.db.Begin()
+	if txn.Error != nil {
+		return decimal.Zero, fmt.Errorf("can't begin transaction")
+	}
+
+	rule := tax.RuleFilter{
+		TaxYear:     req.TaxYear,
+		EffectiveAt: req.EffectiveFrom,
 	}
 
 	var taxAllowance tax.TaxAllowance
-	if result := t.db.Where("allowance_type = ?", req.AllowanceType).First(&taxAllowance); result.Error != nil {
+	if result := t.activeAllowance(txn, req.AllowanceType, &rule).First(&taxAllowance); result.Error != nil {
+		txn.Rollback()
+		return decimal.Zero, fmt.Errorf("can't find tax allowance")
+	}
+
+	newTaxAllowance, err := taxAllowance.WithMaxAmount(req.NewDeductionAmount)
+	if err != nil {
+		txn.Rollback()
+		return decimal.Zero, err
+	}
+
+	newTaxAllowance.Model = gorm.Model{}
+	newTaxAllowance.EffectiveFrom = req.EffectiveFrom
+	if err := txn.Create(&newTaxAllowance).Error; err != nil {
+		txn.Rollback()
+		return decimal.Zero, fmt.Errorf("can't create tax allowance")
+	}
+
+	if err := txn.Commit().Error; err != nil {
+		txn.Rollback()
+		return decimal.Zero, fmt.Errorf("can't commit transaction")
+	}
+
+	return newTaxAllowance.MaxAllowanceAmount, nil
+}
+
+func (t *taxRepository) FindTaxExpense(req *tax.ExpenseFilter) (*tax.TaxExpense, error) {
+	var taxExpense tax.TaxExpense
+	if result := t.db.Where("income_type = ? AND tax_year = ? AND effective_from <= ?", req.IncomeType, req.TaxYear, req.EffectiveAt).Order("effective_from DESC, id DESC").First(&taxExpense); result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			txn.Rollback()
-			return 0, fmt.Errorf("can't find tax allowance")
+			return nil, fmt.Errorf("%w: %s in %d", tax.ErrTaxExpenseNotFound, req.IncomeType, req.TaxYear)
+		}
+
+		return nil, fmt.Errorf("can't find tax expense for %s in %d", req.IncomeType, req.TaxYear)
+	}
+
+	return &taxExpense, nil
+}
+
+// FindTaxExpenses returns the version of each income type that is effective at req.EffectiveAt.
+func (t *taxRepository) FindTaxExpenses(req *tax.RuleFilter) ([]tax.TaxExpense, error) {
+	var taxExpenses []tax.TaxExpense
+	if result := t.db.Select("DISTINCT ON (income_type) *").Where("tax_year = ? AND effective_from <= ?", req.TaxYear, req.EffectiveAt).Order("income_type ASC, effective_from DESC, id DESC").Find(&taxExpenses); result.Error != nil {
+		return nil, fmt.Errorf("can't find tax expenses in %d", req.TaxYear)
+	}
+
+	return taxExpenses, nil
+}
+
+// SetTaxExpense keeps the previous expense deduction and adds a new version that takes effect at req.EffectiveFrom.
+func (t *taxRepository) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	taxExpense := tax.TaxExpense{
+		TaxYear:          req.TaxYear,
+		EffectiveFrom:    req.EffectiveFrom,
+		IncomeType:       req.IncomeType,
+		ExpensePercent:   req.ExpensePercent,
+		MaxExpenseAmount: req.MaxExpenseAmount,
+	}
+	if err := t.db.Create(&taxExpense).Error; err != nil {
+		return nil, fmt.Errorf("can't create tax expense")
+	}
+
+	return &taxExpense, nil
+}
+
+func (t *taxRepository) FindMinimumTax(req *tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	var minimumTax tax.TaxMinimumTax
+	if result := t.db.Where("tax_year = ? AND effective_from <= ?", req.TaxYear, req.EffectiveAt).Order("effective_from DESC, id DESC").First(&minimumTax); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", tax.ErrMinimumTaxNotFound, req.TaxYear)
 		}
 
+		return nil, fmt.Errorf("can't find minimum tax in %d", req.TaxYear)
+	}
+
+	return &minimumTax, nil
+}
+
+// SetMinimumTax keeps the previous minimum tax and adds a new version that takes effect at req.EffectiveFrom.
+func (t *taxRepository) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	minimumTax := tax.TaxMinimumTax{
+		TaxYear:       req.TaxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		MinIncome:     req.MinIncome,
+		TaxPercent:    req.TaxPercent,
+		MaxExemptTax:  req.MaxExemptTax,
+	}
+	if err := t.db.Create(&minimumTax).Error; err != nil {
+		return nil, fmt.Errorf("can't create minimum tax")
+	}
+
+	return &minimumTax, nil
+}
+
+func (t *taxRepository) FindDependentRule(req *tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	var dependentRule tax.TaxDependentRule
+	if result := t.db.Where("tax_year = ? AND effective_from <= ?", req.TaxYear, req.EffectiveAt).Order("effective_from DESC, id DESC").First(&dependentRule); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", tax.ErrDependentRuleNotFound, req.TaxYear)
+		}
+
+		return nil, fmt.Errorf("can't find dependent rule in %d", req.TaxYear)
+	}
+
+	return &dependentRule, nil
+}
+
+// SetDependentRule keeps the previous dependent rule and adds a new version that takes effect at req.EffectiveFrom.
+func (t *taxRepository) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	dependentRule := tax.TaxDependentRule{
+		TaxYear:            req.TaxYear,
+		EffectiveFrom:      req.EffectiveFrom,
+		MaxParents:         req.MaxParents,
+		MinParentAge:       req.MinParentAge,
+		MaxChildAge:        req.MaxChildAge,
+		MaxStudentAge:      req.MaxStudentAge,
+		LaterChildBornFrom: req.LaterChildBornFrom,
+		MaxDependentIncome: req.MaxDependentIncome,
+	}
+	if err := t.db.Create(&dependentRule).Error; err != nil {
+		return nil, fmt.Errorf("can't create dependent rule")
+	}
+
+	return &dependentRule, nil
+}
+
+func (t *taxRepository) FindAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	var allowanceTypes []tax.TaxAllowanceType
+	if result := t.db.Order("id ASC").Find(&allowanceTypes); result.Error != nil {
+		return allowanceTypes, fmt.Errorf("can't find allowance types")
+	}
+
+	return allowanceTypes, nil
+}
+
+func (t *taxRepository) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	var result tax.TaxAllowanceType
+	if err := t.db.Where("allowance_type = ?", allowanceType).First(&result).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", tax.ErrAllowanceTypeNotFound, allowanceType)
+		}
+
+		return nil, fmt.Errorf("can't find allowance type %s", allowanceType)
+	}
+
+	return &result, nil
+}
+
+// CreateAllowanceType adds the allowance type together with its amounts for req.TaxYear.
+func (t *taxRepository) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	txn := t.db.Begin()
+	if txn.Error != nil {
+		return nil, fmt.Errorf("can't begin transaction")
+	}
+
+	var count int64
+	if err := txn.Model(&tax.TaxAllowanceType{}).Unscoped().Where("allowance_type = ?", req.AllowanceType).Count(&count).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't find allowance type %s", req.AllowanceType)
+	}
+
+	if count > 0 {
+		txn.Rollback()
+		return nil, fmt.Errorf("%w: %s", tax.ErrAllowanceTypeExists, req.AllowanceType)
+	}
+
+	allowanceType := tax.TaxAllowanceType{
+		AllowanceType:    req.AllowanceType,
+		DisplayName:      req.DisplayName,
+		Source:           req.Source,
+		ValidationMethod: req.ValidationMethod,
+	}
+	if err := txn.Create(&allowanceType).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't create allowance type")
+	}
+
+	taxAllowance := tax.TaxAllowance{
+		TaxYear:             req.TaxYear,
+		EffectiveFrom:       req.EffectiveFrom,
+		AllowanceType:       req.AllowanceType,
+		AllowanceGroup:      req.AllowanceGroup,
+		Enabled:             true,
+		MinAllowanceAmount:  req.MinAllowanceAmount,
+		MaxAllowanceAmount:  req.MaxAllowanceAmount,
+		MaxIncomePercent:    req.MaxIncomePercent,
+		IncomeType:          req.IncomeType,
+		DeductionMultiplier: req.DeductionMultiplier,
+		AdminMinAmount:      req.AdminMinAmount,
+		AdminMaxAmount:      req.AdminMaxAmount,
+	}
+	if err := txn.Create(&taxAllowance).Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't create tax allowance")
+	}
+
+	if err := txn.Commit().Error; err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("can't commit transaction")
+	}
+
+	return &allowanceType, nil
+}
+
+// DisableAllowanceType keeps the previous allowance and adds a disabled version that takes effect at req.EffectiveFrom,
+// so the results of the earlier versions can still be calculated again.
+func (t *taxRepository) DisableAllowanceType(req *tax.DisableAllowance) error {
+	txn := t.db.Begin()
+	if txn.Error != nil {
+		return fmt.Errorf("can't begin transaction")
+	}
+
+	rule := tax.RuleFilter{
+		TaxYear:     req.TaxYear,
+		EffectiveAt: req.EffectiveFrom,
+	}
+
+	var taxAllowance tax.TaxAllowance
+	if result := t.activeAllowance(txn, req.AllowanceType, &rule).First(&taxAllowance); result.Error != nil {
 		txn.Rollback()
-		return 0, fmt.Errorf("can't find tax allowance")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s in %d", tax.ErrAllowanceTypeNotFound, req.AllowanceType, req.TaxYear)
+		}
+
+		return fmt.Errorf("can't find tax allowance")
 	}
 
-	taxAllowance.MaxAllowanceAmount = req.NewDeductionAmount
-	if err := txn.Save(&taxAllowance).Error; err != nil {
+	taxAllowance.Model = gorm.Model{}
+	taxAllowance.EffectiveFrom = req.EffectiveFrom
+	taxAllowance.Enabled = false
+	if err := txn.Create(&taxAllowance).Error; err != nil {
 		txn.Rollback()
-		return 0, fmt.Errorf("can't update tax allowance")
+		return fmt.Errorf("can't disable allowance type %s", req.AllowanceType)
 	}
 
 	if err := txn.Commit().Error; err != nil {
 		txn.Rollback()
-		return 0, fmt.Errorf("can't commit transaction")
+		return fmt.Errorf("can't commit transaction")
+	}
+
+	return nil
+}
+
+func (t *taxRepository) CreateTaxCalculations(calculations []tax.TaxCalculation) ([]tax.TaxCalculation, error) {
+	if err := t.db.CreateInBatches(&calculations, 500).Error; err != nil {
+		return nil, fmt.Errorf("can't create tax calculation")
+	}
+
+	return calculations, nil
+}
+
+func (t *taxRepository) FindTaxCalculation(id uint) (*tax.TaxCalculation, error) {
+	var calculation tax.TaxCalculation
+	if result := t.db.First(&calculation, id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", tax.ErrTaxCalculationNotFound, id)
+		}
+
+		return nil, fmt.Errorf("can't find tax calculation %d", id)
+	}
+
+	return &calculation, nil
+}
+
+func (t *taxRepository) FindTaxCalculations(req *tax.TaxCalculationFilter) ([]tax.TaxCalculation, int64, error) {
+	query := t.db.Model(&tax.TaxCalculation{})
+	if req.Source != "" {
+		query = query.Where("source = ?", req.Source)
+	}
+
+	if req.TaxYear != 0 {
+		query = query.Where("tax_year = ?", req.TaxYear)
+	}
+
+	if !req.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", req.CreatedFrom)
+	}
+
+	if !req.CreatedTo.IsZero() {
+		query = query.Where("created_at < ?", req.CreatedTo)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("can't count tax calculations")
+	}
+
+	var calculations []tax.TaxCalculation
+	if err := query.Order("id DESC").Offset(req.Offset).Limit(req.Limit).Find(&calculations).Error; err != nil {
+		return nil, 0, fmt.Errorf("can't find tax calculations")
+	}
+
+	return calculations, total, nil
+}
+
+func (t *taxRepository) CreateTaxJob(totalRows int) (*tax.TaxJob, error) {
+	job := tax.TaxJob{
+		Status:    tax.TaxJobPending,
+		TotalRows: totalRows,
+	}
+	if err := t.db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("can't create tax job")
+	}
+
+	return &job, nil
+}
+
+func (t *taxRepository) FindTaxJob(id uint) (*tax.TaxJob, error) {
+	var job tax.TaxJob
+	if result := t.db.First(&job, id); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", tax.ErrTaxJobNotFound, id)
+		}
+
+		return nil, fmt.Errorf("can't find tax job %d", id)
+	}
+
+	return &job, nil
+}
+
+func (t *taxRepository) SetTaxJobProgress(id uint, processedRows int) error {
+	result := t.db.Model(&tax.TaxJob{}).Where("id = ? AND status IN ?", id, []string{tax.TaxJobPending, tax.TaxJobRunning}).
+		Updates(map[string]interface{}{"status": tax.TaxJobRunning, "processed_rows": gorm.Expr("GREATEST(processed_rows, ?)", processedRows)})
+	if result.Error != nil {
+		return fmt.Errorf("can't update tax job %d", id)
+	}
+
+	return nil
+}
+
+func (t *taxRepository) FinishTaxJob(id uint, status string, result *string, message string) error {
+	if err := t.db.Model(&tax.TaxJob{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "result": result, "message": message}).Error; err != nil {
+		return fmt.Errorf("can't finish tax job %d", id)
+	}
+
+	return nil
+}
+
+func (t *taxRepository) FailUnfinishedTaxJobs(message string) (int64, error) {
+	result := t.db.Model(&tax.TaxJob{}).Where("status IN ?", []string{tax.TaxJobPending, tax.TaxJobRunning}).
+		Updates(map[string]interface{}{"status": tax.TaxJobFailed, "message": message})
+	if result.Error != nil {
+		return 0, fmt.Errorf("can't fail unfinished tax jobs")
 	}
 
-	return taxAllowance.MaxAllowanceAmount, nil
+	return result.RowsAffected, nil
 }
@@ -0,0 +1,96 @@
+package taxUsecases
+
+import (
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"sync"
+)
+
+// IAllowanceRule decides how an allowance is validated and how much of it is deducted from the net income.
+type IAllowanceRule interface {
+	Validate(allowance TaxAllowanceDetails, baseline AllowanceBaseline) error
+	Deduct(allowance TaxAllowanceDetails, baseline AllowanceBaseline, netIncome decimal.Decimal) decimal.Decimal
+}
+
+// AllowanceBaseline is the active version of an allowance, the percent of income and the group are enforced
+// after the rule by DecreaseAllowance.
+type AllowanceBaseline struct {
+	MinAmount        decimal.Decimal
+	MaxAmount        decimal.Decimal
+	MaxIncomePercent *decimal.Decimal
+	IncomeType       string
+	AllowanceGroup   string
+	Multiplier       decimal.Decimal
+}
+
+type rangeAllowanceRule struct{}
+
+type capAllowanceRule struct{}
+
+type donationAllowanceRule struct{}
+
+var (
+	allowanceRulesMu sync.RWMutex
+	allowanceRules   = map[string]IAllowanceRule{
+		tax.AllowanceValidationRange:    rangeAllowanceRule{},
+		tax.AllowanceValidationCap:      capAllowanceRule{},
+		tax.AllowanceValidationDonation: donationAllowanceRule{},
+	}
+)
+
+// RegisterAllowanceRule adds or replaces the rule for name, name is either an allowance type or a validation method.
+func RegisterAllowanceRule(name string, rule IAllowanceRule) {
+	allowanceRulesMu.Lock()
+	defer allowanceRulesMu.Unlock()
+
+	allowanceRules[name] = rule
+}
+
+// FindAllowanceRule returns the rule of the first name that is registered.
+func FindAllowanceRule(names ...string) (IAllowanceRule, bool) {
+	allowanceRulesMu.RLock()
+	defer allowanceRulesMu.RUnlock()
+
+	for _, name := range names {
+		if rule, ok := allowanceRules[name]; ok {
+			return rule, true
+		}
+	}
+
+	return nil, false
+}
+
+func (rangeAllowanceRule) Validate(allowance TaxAllowanceDetails, baseline AllowanceBaseline) error {
+	if allowance.Amount.LessThan(baseline.MinAmount) || allowance.Amount.GreaterThan(baseline.MaxAmount) {
+		return fmt.Errorf("%s amount must be between %s and %s", allowance.AllowanceType, baseline.MinAmount.String(), baseline.MaxAmount.String())
+	}
+
+	return nil
+}
+
+func (rangeAllowanceRule) Deduct(allowance TaxAllowanceDetails, baseline AllowanceBaseline, netIncome decimal.Decimal) decimal.Decimal {
+	return allowance.Amount
+}
+
+// Validate accepts an amount over the max amount, Deduct only deducts up to the max amount.
+func (capAllowanceRule) Validate(allowance TaxAllowanceDetails, baseline AllowanceBaseline) error {
+	if allowance.Amount.LessThan(baseline.MinAmount) {
+		return fmt.Errorf("%s amount must be at least %s", allowance.AllowanceType, baseline.MinAmount.String())
+	}
+
+	return nil
+}
+
+func (capAllowanceRule) Deduct(allowance TaxAllowanceDetails, baseline AllowanceBaseline, netIncome decimal.Decimal) decimal.Decimal {
+	return decimal.Min(allowance.Amount, baseline.MaxAmount)
+}
+
+func (donationAllowanceRule) Validate(allowance TaxAllowanceDetails, baseline AllowanceBaseline) error {
+	return capAllowanceRule{}.Validate(allowance, baseline)
+}
+
+// Deduct counts the donation up to the max amount as many times as the multiplier, such as twice for education.
+func (donationAllowanceRule) Deduct(allowance TaxAllowanceDetails, baseline AllowanceBaseline, netIncome decimal.Decimal) decimal.Decimal {
+	return decimal.Min(allowance.Amount, baseline.MaxAmount).Mul(baseline.Multiplier)
+}
@@ -0,0 +1,172 @@
+package taxUsecases
+
+import (
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+type TaxSpouse struct {
+	HasIncome bool `json:"hasIncome"`
+}
+
+// TaxChild is a child of the taxpayer, children are listed in birth order.
+type TaxChild struct {
+	BirthDate time.Time `json:"birthDate"`
+	Studying  bool      `json:"studying"`
+}
+
+// TaxParent is a parent of the taxpayer or of the spouse, the age is at the end of the tax year like a child's.
+type TaxParent struct {
+	BirthDate time.Time       `json:"birthDate"`
+	Income    decimal.Decimal `json:"income"`
+}
+
+type TaxDisabledDependent struct {
+	Income decimal.Decimal `json:"income"`
+}
+
+type TaxDependents struct {
+	Spouse             *TaxSpouse             `json:"spouse,omitempty"`
+	Children           []TaxChild             `json:"children,omitempty"`
+	Parents            []TaxParent            `json:"parents,omitempty"`
+	DisabledDependents []TaxDisabledDependent `json:"disabledDependents,omitempty"`
+}
+
+// allowanceType returns the allowance of the child at index in birth order, a child that is too old has none.
+func (c TaxChild) allowanceType(index, taxYear int, rule *tax.TaxDependentRule) (string, bool) {
+	age := ageInTaxYear(c.BirthDate, taxYear)
+	if age >= rule.MaxStudentAge || (age >= rule.MaxChildAge && !c.Studying) {
+		return "", false
+	}
+
+	if index > 0 && !c.BirthDate.Before(rule.LaterChildBornFrom) {
+		return tax.AllowanceTypeLaterChild, true
+	}
+
+	return tax.AllowanceTypeChild, true
+}
+
+func (u *taxUsecase) GetDependentRule(rule tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	result, err := u.taxRepository.FindDependentRule(&rule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependent rule: %w", err)
+	}
+
+	return result, nil
+}
+
+func (u *taxUsecase) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	result, err := u.taxRepository.SetDependentRule(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set dependent rule: %v", err)
+	}
+
+	return result, nil
+}
+
+// ValidateDependents checks that every dependent can be claimed under the dependent rule of the request, the tax year
+// of the request must be resolved first. Children that are too old are kept because they still count in the birth
+// order of the younger children.
+func (u *taxUsecase) ValidateDependents(req *CalculateTaxRequest) error {
+	if req.Dependents == nil {
+		return nil
+	}
+
+	if req.Dependents.Spouse != nil && req.Dependents.Spouse.HasIncome {
+		return fmt.Errorf("%s allowance is only for a spouse without income", tax.AllowanceTypeSpouse)
+	}
+
+	for i, child := range req.Dependents.Children {
+		if child.BirthDate.IsZero() || ageInTaxYear(child.BirthDate, req.TaxYear) < 0 {
+			return fmt.Errorf("birth date of child %d is required and must not be after tax year %d", i+1, req.TaxYear)
+		}
+	}
+
+	for i, parent := range req.Dependents.Parents {
+		if parent.BirthDate.IsZero() || ageInTaxYear(parent.BirthDate, req.TaxYear) < 0 {
+			return fmt.Errorf("birth date of parent %d is required and must not be after tax year %d", i+1, req.TaxYear)
+		}
+	}
+
+	if len(req.Dependents.Parents) == 0 && len(req.Dependents.DisabledDependents) == 0 {
+		return nil
+	}
+
+	rule, err := u.GetDependentRule(req.RuleFilter())
+	if err != nil {
+		return err
+	}
+
+	if len(req.Dependents.Parents) > rule.MaxParents {
+		return fmt.Errorf("at most %d parents can be claimed", rule.MaxParents)
+	}
+
+	for i, parent := range req.Dependents.Parents {
+		if ageInTaxYear(parent.BirthDate, req.TaxYear) < rule.MinParentAge {
+			return fmt.Errorf("parent %d must be at least %d years old", i+1, rule.MinParentAge)
+		}
+
+		if parent.Income.IsNegative() || parent.Income.GreaterThan(rule.MaxDependentIncome) {
+			return fmt.Errorf("income of parent %d must be between 0 and %s", i+1, rule.MaxDependentIncome.String())
+		}
+	}
+
+	for i, dependent := range req.Dependents.DisabledDependents {
+		if dependent.Income.IsNegative() || dependent.Income.GreaterThan(rule.MaxDependentIncome) {
+			return fmt.Errorf("income of disabled dependent %d must be between 0 and %s", i+1, rule.MaxDependentIncome.String())
+		}
+	}
+
+	return nil
+}
+
+// DependentAllowances turns the dependents of the request into allowances, each dependent is deducted by the max amount
+// of its allowance type and an allowance type that is disabled is not deducted.
+func (u *taxUsecase) DependentAllowances(req *CalculateTaxRequest) ([]TaxAllowanceDetails, error) {
+	if req.Dependents == nil {
+		return nil, nil
+	}
+
+	counts := make(map[string]int64)
+	if req.Dependents.Spouse != nil {
+		counts[tax.AllowanceTypeSpouse]++
+	}
+	if len(req.Dependents.Children) > 0 {
+		rule, err := u.GetDependentRule(req.RuleFilter())
+		if err != nil {
+			return nil, err
+		}
+
+		for i, child := range req.Dependents.Children {
+			if allowanceType, ok := child.allowanceType(i, req.TaxYear, rule); ok {
+				counts[allowanceType]++
+			}
+		}
+	}
+	counts[tax.AllowanceTypeParent] += int64(len(req.Dependents.Parents))
+	counts[tax.AllowanceTypeDisabledDependent] += int64(len(req.Dependents.DisabledDependents))
+
+	var result []TaxAllowanceDetails
+	for _, allowanceType := range tax.DependentAllowanceTypes {
+		if counts[allowanceType] == 0 {
+			continue
+		}
+
+		allowance, err := u.FindAllowance(allowanceType, req.RuleFilter())
+		if err != nil {
+			return nil, err
+		}
+		if !allowance.Enabled {
+			continue
+		}
+
+		result = append(result, TaxAllowanceDetails{
+			AllowanceType: allowanceType,
+			Amount:        allowance.MaxAllowanceAmount.Mul(decimal.NewFromInt(counts[allowanceType])),
+		})
+	}
+
+	return result, nil
+}
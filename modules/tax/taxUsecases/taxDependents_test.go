@@ -0,0 +1,137 @@
+package taxUsecases
+
+import (
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTaxUsecase_ValidateDependents(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name        string
+		dependents  *TaxDependents
+		expectedErr bool
+	}{
+		{name: "no dependents"},
+		{
+			name: "eligible dependents",
+			dependents: &TaxDependents{
+				Spouse:             &TaxSpouse{},
+				Children:           []TaxChild{{BirthDate: *birthDate(1997)}, {BirthDate: *birthDate(2019)}},
+				Parents:            []TaxParent{{BirthDate: *birthDate(1964), Income: decimal.NewFromInt(30000)}},
+				DisabledDependents: []TaxDisabledDependent{{Income: decimal.Zero}},
+			},
+		},
+		{name: "spouse with income", dependents: &TaxDependents{Spouse: &TaxSpouse{HasIncome: true}}, expectedErr: true},
+		{name: "child born after tax year", dependents: &TaxDependents{Children: []TaxChild{{BirthDate: *birthDate(2025)}}}, expectedErr: true},
+		{name: "child without birth date", dependents: &TaxDependents{Children: []TaxChild{{}}}, expectedErr: true},
+		{name: "parent without birth date", dependents: &TaxDependents{Parents: []TaxParent{{}}}, expectedErr: true},
+		{name: "young parent", dependents: &TaxDependents{Parents: []TaxParent{{BirthDate: *birthDate(1965)}}}, expectedErr: true},
+		{name: "parent with income", dependents: &TaxDependents{Parents: []TaxParent{{BirthDate: *birthDate(1954), Income: decimal.NewFromInt(30001)}}}, expectedErr: true},
+		{name: "too many parents", dependents: &TaxDependents{Parents: []TaxParent{{BirthDate: *birthDate(1964)}, {BirthDate: *birthDate(1964)}, {BirthDate: *birthDate(1964)}, {BirthDate: *birthDate(1964)}, {BirthDate: *birthDate(1964)}}}, expectedErr: true},
+		{name: "disabled dependent with income", dependents: &TaxDependents{DisabledDependents: []TaxDisabledDependent{{Income: decimal.NewFromInt(50000)}}}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := usecase.ValidateDependents(&CalculateTaxRequest{TaxYear: testRule.TaxYear, EffectiveAt: testRule.EffectiveAt, Dependents: tc.dependents})
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTaxUsecase_DependentAllowances(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		Dependents: &TaxDependents{
+			Spouse: &TaxSpouse{},
+			Children: []TaxChild{
+				{BirthDate: *birthDate(1997)},
+				{BirthDate: *birthDate(2002), Studying: true},
+				{BirthDate: *birthDate(2019)},
+			},
+			Parents:            []TaxParent{{BirthDate: *birthDate(1959)}, {BirthDate: *birthDate(1954)}},
+			DisabledDependents: []TaxDisabledDependent{{}},
+		},
+	}
+
+	result, err := usecase.DependentAllowances(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []TaxAllowanceDetails{
+		{AllowanceType: tax.AllowanceTypeSpouse, Amount: decimal.NewFromInt(60000)},
+		{AllowanceType: tax.AllowanceTypeChild, Amount: decimal.NewFromInt(30000)},
+		{AllowanceType: tax.AllowanceTypeLaterChild, Amount: decimal.NewFromInt(60000)},
+		{AllowanceType: tax.AllowanceTypeParent, Amount: decimal.NewFromInt(60000)},
+	}, result)
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_Dependents(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(600000),
+		Dependents:  &TaxDependents{Spouse: &TaxSpouse{}, Children: []TaxChild{{BirthDate: *birthDate(2017)}}},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Len(t, result.DependentAllowances, 2)
+	assert.Equal(t, "16000", result.Tax.String())
+}
+
+func TestTaxUsecase_ValidateDependents_NoDependentRule(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	err := usecase.ValidateDependents(&CalculateTaxRequest{TaxYear: 2566, Dependents: &TaxDependents{Parents: []TaxParent{{BirthDate: *birthDate(1954)}}}})
+
+	assert.ErrorIs(t, err, tax.ErrDependentRuleNotFound)
+}
+
+func TestTaxChild_AllowanceType(t *testing.T) {
+	rule := &tax.TaxDependentRule{
+		MaxChildAge:        20,
+		MaxStudentAge:      25,
+		LaterChildBornFrom: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	testCases := []struct {
+		name          string
+		child         TaxChild
+		index         int
+		expectedType  string
+		expectedClaim bool
+	}{
+		{name: "first child born after the later child date", child: TaxChild{BirthDate: *birthDate(2019)}, expectedType: tax.AllowanceTypeChild, expectedClaim: true},
+		{name: "second child born on the later child date", child: TaxChild{BirthDate: rule.LaterChildBornFrom}, index: 1, expectedType: tax.AllowanceTypeLaterChild, expectedClaim: true},
+		{name: "second child born before the later child date", child: TaxChild{BirthDate: *birthDate(2017)}, index: 1, expectedType: tax.AllowanceTypeChild, expectedClaim: true},
+		{name: "adult student", child: TaxChild{BirthDate: *birthDate(2002), Studying: true}, expectedType: tax.AllowanceTypeChild, expectedClaim: true},
+		{name: "adult not studying", child: TaxChild{BirthDate: *birthDate(2002)}},
+		{name: "too old to study", child: TaxChild{BirthDate: *birthDate(1999), Studying: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			allowanceType, ok := tc.child.allowanceType(tc.index, 2567, rule)
+
+			assert.Equal(t, tc.expectedClaim, ok)
+			assert.Equal(t, tc.expectedType, allowanceType)
+		})
+	}
+}
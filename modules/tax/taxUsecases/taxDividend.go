@@ -0,0 +1,62 @@
+package taxUsecases
+
+import (
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+)
+
+// TaxDividend is a dividend that the taxpayer includes in the income to claim back the corporate tax,
+// CorporateTaxRate is the percent of tax that the company paid on the profit of the dividend.
+type TaxDividend struct {
+	Amount           decimal.Decimal `json:"amount"`
+	CorporateTaxRate decimal.Decimal `json:"corporateTaxRate"`
+	Wht              decimal.Decimal `json:"wht"`
+}
+
+func (u *taxUsecase) validateDividends(req *CalculateTaxRequest) error {
+	for i, dividend := range req.Dividends {
+		if dividend.Amount.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("amount of dividend %d must be greater than zero", i+1)
+		}
+
+		if dividend.CorporateTaxRate.IsNegative() || dividend.CorporateTaxRate.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+			return fmt.Errorf("corporate tax rate of dividend %d must be at least 0 and less than 100", i+1)
+		}
+
+		if dividend.Wht.IsNegative() || dividend.Wht.GreaterThan(dividend.Amount) {
+			return fmt.Errorf("wht of dividend %d must be between 0 and its amount", i+1)
+		}
+	}
+
+	return nil
+}
+
+// TaxCredit returns the corporate tax that was paid on the dividend, that is amount * rate / (100 - rate).
+func (u *taxUsecase) TaxCredit(dividend TaxDividend) decimal.Decimal {
+	hundred := decimal.NewFromInt(100)
+	return u.rounding.Round(dividend.Amount.Mul(dividend.CorporateTaxRate).Div(hundred.Sub(dividend.CorporateTaxRate)))
+}
+
+// incomeDetails returns the incomes of the request together with the dividends, a dividend is grossed up by its tax credit.
+func (u *taxUsecase) incomeDetails(req *CalculateTaxRequest) []TaxIncomeDetails {
+	result := req.IncomeDetails()
+	for _, dividend := range req.Dividends {
+		result = append(result, TaxIncomeDetails{
+			IncomeType: tax.IncomeTypeDividend,
+			Amount:     dividend.Amount.Add(u.TaxCredit(dividend)),
+			Wht:        dividend.Wht,
+		})
+	}
+
+	return result
+}
+
+func (u *taxUsecase) taxCredit(req *CalculateTaxRequest) decimal.Decimal {
+	result := decimal.Zero
+	for _, dividend := range req.Dividends {
+		result = result.Add(u.TaxCredit(dividend))
+	}
+
+	return result
+}
@@ -0,0 +1,103 @@
+package taxUsecases
+
+import (
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTaxUsecase_TaxCredit(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name     string
+		dividend TaxDividend
+		expected string
+	}{
+		{name: "20 percent", dividend: TaxDividend{Amount: decimal.NewFromInt(80000), CorporateTaxRate: decimal.NewFromInt(20)}, expected: "20000"},
+		{name: "30 percent", dividend: TaxDividend{Amount: decimal.NewFromInt(10000), CorporateTaxRate: decimal.NewFromInt(30)}, expected: "4285.71"},
+		{name: "exempt company", dividend: TaxDividend{Amount: decimal.NewFromInt(10000), CorporateTaxRate: decimal.Zero}, expected: "0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, usecase.TaxCredit(tc.dividend).String())
+		})
+	}
+}
+
+func TestTaxUsecase_ValidateDividends(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name        string
+		dividends   []TaxDividend
+		expectedErr bool
+	}{
+		{name: "no dividends"},
+		{name: "valid dividend", dividends: []TaxDividend{{Amount: decimal.NewFromInt(80000), CorporateTaxRate: decimal.NewFromInt(20), Wht: decimal.NewFromInt(8000)}}},
+		{name: "zero amount", dividends: []TaxDividend{{CorporateTaxRate: decimal.NewFromInt(20)}}, expectedErr: true},
+		{name: "rate of 100", dividends: []TaxDividend{{Amount: decimal.NewFromInt(80000), CorporateTaxRate: decimal.NewFromInt(100)}}, expectedErr: true},
+		{name: "wht over amount", dividends: []TaxDividend{{Amount: decimal.NewFromInt(80000), Wht: decimal.NewFromInt(90000)}}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := usecase.validateDividends(&CalculateTaxRequest{Dividends: tc.dividends})
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTaxUsecase_CalculateBulkTax_Dividends(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(500000),
+		Dividends: []TaxDividend{
+			{Amount: decimal.NewFromInt(80000), CorporateTaxRate: decimal.NewFromInt(20), Wht: decimal.NewFromInt(8000)},
+		},
+	}
+
+	record, err := usecase.CalculateBulkTax(req, tax.CalculationSourceAPI)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "0", record.TotalTax.String())
+	assert.Equal(t, "3000", record.TaxRefund.String())
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_DividendMinimumTax(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		Incomes: []TaxIncomeDetails{
+			{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(1300000)},
+		},
+		Dividends: []TaxDividend{
+			{Amount: decimal.NewFromInt(80000), CorporateTaxRate: decimal.NewFromInt(20)},
+		},
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "rmf", Amount: decimal.NewFromInt(390000)},
+			{AllowanceType: "life-insurance", Amount: decimal.NewFromInt(100000)},
+		},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "20000", result.TaxCredit.String())
+	assert.Equal(t, tax.TaxMethodMinimum, result.Method)
+	assert.Equal(t, "6900", result.MinimumTax.String())
+	assert.Equal(t, "6900", result.Tax.String())
+}
@@ -0,0 +1,54 @@
+package taxUsecases
+
+import (
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const minElderlyAge = 65
+
+// TaxTaxpayer is who the taxpayer is, it decides whether the income exemption of the elderly and the disabled applies.
+type TaxTaxpayer struct {
+	BirthDate *time.Time `json:"birthDate,omitempty"`
+	Disabled  bool       `json:"disabled"`
+}
+
+func (t TaxTaxpayer) age(taxYear int) int {
+	return ageInTaxYear(*t.BirthDate, taxYear)
+}
+
+func (t TaxTaxpayer) isExempt(taxYear int) bool {
+	return t.Disabled || (t.BirthDate != nil && t.age(taxYear) >= minElderlyAge)
+}
+
+func (u *taxUsecase) validateTaxpayer(req *CalculateTaxRequest) error {
+	if req.Taxpayer == nil || req.Taxpayer.BirthDate == nil {
+		return nil
+	}
+
+	if req.Taxpayer.age(req.TaxYear) < 0 {
+		return fmt.Errorf("birth date must not be after tax year %d", req.TaxYear)
+	}
+
+	return nil
+}
+
+// IncomeExemption returns the income exemption of a taxpayer who is at least 65 years old or disabled, it is the max
+// amount of the income exemption allowance and a taxpayer who is both gets it once.
+func (u *taxUsecase) IncomeExemption(req *CalculateTaxRequest) (decimal.Decimal, error) {
+	if req.Taxpayer == nil || !req.Taxpayer.isExempt(req.TaxYear) {
+		return decimal.Zero, nil
+	}
+
+	allowance, err := u.FindAllowance(tax.AllowanceTypeIncomeExemption, req.RuleFilter())
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !allowance.Enabled {
+		return decimal.Zero, nil
+	}
+
+	return allowance.MaxAllowanceAmount, nil
+}
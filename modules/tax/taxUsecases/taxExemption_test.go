@@ -0,0 +1,119 @@
+package taxUsecases
+
+import (
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func birthDate(year int) *time.Time {
+	result := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	return &result
+}
+
+func TestTaxUsecase_IncomeExemption(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name     string
+		taxpayer *TaxTaxpayer
+		expected string
+	}{
+		{name: "no taxpayer", expected: "0"},
+		{name: "younger than 65", taxpayer: &TaxTaxpayer{BirthDate: birthDate(1960)}, expected: "0"},
+		{name: "65 at the end of the tax year", taxpayer: &TaxTaxpayer{BirthDate: birthDate(1959)}, expected: "190000"},
+		{name: "disabled", taxpayer: &TaxTaxpayer{Disabled: true}, expected: "190000"},
+		{name: "elderly and disabled", taxpayer: &TaxTaxpayer{BirthDate: birthDate(1950), Disabled: true}, expected: "190000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := usecase.IncomeExemption(&CalculateTaxRequest{TaxYear: testRule.TaxYear, EffectiveAt: testRule.EffectiveAt, Taxpayer: tc.taxpayer})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result.String())
+		})
+	}
+}
+
+func TestTaxUsecase_ValidateTaxpayer(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	assert.NoError(t, usecase.validateTaxpayer(&CalculateTaxRequest{TaxYear: 2567, Taxpayer: &TaxTaxpayer{BirthDate: birthDate(1959)}}))
+	assert.Error(t, usecase.validateTaxpayer(&CalculateTaxRequest{TaxYear: 2567, Taxpayer: &TaxTaxpayer{BirthDate: birthDate(2025)}}))
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_IncomeExemption(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(1000000),
+		Taxpayer:    &TaxTaxpayer{Disabled: true},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "190000", result.Exemption.String())
+	assert.Equal(t, "51500", result.Tax.String())
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_IncomeExemptionBeforeExpense(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name              string
+		incomes           []TaxIncomeDetails
+		expectedExpense   string
+		expectedExemption string
+		expectedTax       string
+	}{
+		{
+			name:              "salary",
+			incomes:           []TaxIncomeDetails{{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(250000)}},
+			expectedExpense:   "30000",
+			expectedExemption: "190000",
+			expectedTax:       "0",
+		},
+		{
+			// with the expense first the salary expense is 100000 and the tax is 13000
+			name: "salary and rental",
+			incomes: []TaxIncomeDetails{
+				{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(250000)},
+				{IncomeType: tax.IncomeTypeRental, Amount: decimal.NewFromInt(600000)},
+			},
+			expectedExpense:   "210000",
+			expectedExemption: "190000",
+			expectedTax:       "20000",
+		},
+		{
+			name:              "income below the exemption",
+			incomes:           []TaxIncomeDetails{{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(100000)}},
+			expectedExpense:   "0",
+			expectedExemption: "100000",
+			expectedTax:       "0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &CalculateTaxRequest{
+				TaxYear:     testRule.TaxYear,
+				EffectiveAt: testRule.EffectiveAt,
+				Incomes:     tc.incomes,
+				Taxpayer:    &TaxTaxpayer{BirthDate: birthDate(1955)},
+			}
+
+			result, err := usecase.CalculateTaxWithoutWHT(req)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedExpense, result.Expense.String())
+			assert.Equal(t, tc.expectedExemption, result.Exemption.String())
+			assert.Equal(t, tc.expectedTax, result.Tax.String())
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package taxUsecases
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"strings"
+)
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+
+	MIMETextCSV = "text/csv"
+	MIMEXLSX    = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	taxExportSheet      = "taxes"
+	taxExportErrorSheet = "rejected"
+)
+
+// TaxExportRow is a calculated row of an uploaded file together with its tax breakdown.
+type TaxExportRow struct {
+	Request    *CalculateTaxRequest
+	Expense    decimal.Decimal
+	Tax        decimal.Decimal
+	TaxRefund  decimal.Decimal
+	TaxMethod  string
+	BracketTax decimal.Decimal
+	MinimumTax *decimal.Decimal
+	TaxLevels  []TaxLevelResponse
+}
+
+// TaxExport writes the result of an uploaded file as a table, Columns are the input columns in the order of the file.
+type TaxExport struct {
+	Columns  []string
+	Rows     []TaxExportRow
+	Rejected []RowError
+}
+
+// ExportFormat returns the format asked by the format query parameter, or else by the Accept header.
+func ExportFormat(format, accept string) (string, error) {
+	switch strings.ToLower(format) {
+	case ExportFormatJSON, ExportFormatCSV, ExportFormatXLSX:
+		return strings.ToLower(format), nil
+	case "":
+	default:
+		return "", fmt.Errorf("format must be %s, %s or %s", ExportFormatJSON, ExportFormatCSV, ExportFormatXLSX)
+	}
+
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		switch strings.TrimSpace(mediaType) {
+		case MIMETextCSV:
+			return ExportFormatCSV, nil
+		case MIMEXLSX:
+			return ExportFormatXLSX, nil
+		}
+	}
+
+	return ExportFormatJSON, nil
+}
+
+func (e *TaxExport) taxLevels() []string {
+	var levels []string
+	seen := make(map[string]bool)
+	for _, row := range e.Rows {
+		for _, taxLevel := range row.TaxLevels {
+			if !seen[taxLevel.Level] {
+				seen[taxLevel.Level] = true
+				levels = append(levels, taxLevel.Level)
+			}
+		}
+	}
+
+	return levels
+}
+
+func (e *TaxExport) header(levels []string) []string {
+	header := append([]string{"line"}, e.Columns...)
+	header = append(header, "expense", "tax", "taxRefund", "taxMethod", "bracketTax", "minimumTax")
+	for _, level := range levels {
+		header = append(header, fmt.Sprintf("tax %s", level))
+	}
+
+	return header
+}
+
+func (e *TaxExport) input(req *CalculateTaxRequest, column string) interface{} {
+	switch column {
+	case tax.CSVColumnReference:
+		return req.Reference
+	case tax.CSVColumnTotalIncome:
+		return req.TotalIncome
+	case tax.CSVColumnWht:
+		return req.Wht
+	}
+
+	for _, allowance := range req.Allowances {
+		if allowance.AllowanceType == column {
+			return allowance.Amount
+		}
+	}
+
+	return nil
+}
+
+// table returns the rows of the export, amounts are kept as decimals so that each writer decides how to write them.
+func (e *TaxExport) table() [][]interface{} {
+	levels := e.taxLevels()
+	header := e.header(levels)
+
+	table := make([][]interface{}, 0, len(e.Rows)+1)
+	table = append(table, make([]interface{}, 0, len(header)))
+	for _, column := range header {
+		table[0] = append(table[0], column)
+	}
+
+	for _, row := range e.Rows {
+		values := make([]interface{}, 0, len(header))
+		values = append(values, row.Request.Line)
+		for _, column := range e.Columns {
+			values = append(values, e.input(row.Request, column))
+		}
+		values = append(values, row.Expense, row.Tax, row.TaxRefund, row.TaxMethod, row.BracketTax)
+		if row.MinimumTax != nil {
+			values = append(values, *row.MinimumTax)
+		} else {
+			values = append(values, nil)
+		}
+
+		taxByLevel := make(map[string]decimal.Decimal, len(row.TaxLevels))
+		for _, taxLevel := range row.TaxLevels {
+			taxByLevel[taxLevel.Level] = taxLevel.Tax
+		}
+		for _, level := range levels {
+			values = append(values, taxByLevel[level])
+		}
+
+		table = append(table, values)
+	}
+
+	return table
+}
+
+func (e *TaxExport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	for _, values := range e.table() {
+		record := make([]string, 0, len(values))
+		for _, value := range values {
+			switch value := value.(type) {
+			case nil:
+				record = append(record, "")
+			case decimal.Decimal:
+				record = append(record, value.String())
+			default:
+				record = append(record, fmt.Sprint(value))
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write csv: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %v", err)
+	}
+
+	return nil
+}
+
+// WriteXLSX writes the rows to the taxes sheet, the rejected rows of a partial upload are written to the rejected sheet.
+func (e *TaxExport) WriteXLSX(w io.Writer) error {
+	file := excelize.NewFile()
+	defer func(file *excelize.File) {
+		_ = file.Close()
+	}(file)
+
+	if err := file.SetSheetName(file.GetSheetName(0), taxExportSheet); err != nil {
+		return fmt.Errorf("failed to write xlsx: %v", err)
+	}
+
+	for i, values := range e.table() {
+		for j, value := range values {
+			if amount, ok := value.(decimal.Decimal); ok {
+				values[j] = amount.InexactFloat64()
+			}
+		}
+
+		if err := e.setRow(file, taxExportSheet, i+1, values); err != nil {
+			return err
+		}
+	}
+
+	if len(e.Rejected) > 0 {
+		if _, err := file.NewSheet(taxExportErrorSheet); err != nil {
+			return fmt.Errorf("failed to write xlsx: %v", err)
+		}
+
+		if err := e.setRow(file, taxExportErrorSheet, 1, []interface{}{"line", "column", "message"}); err != nil {
+			return err
+		}
+		for i, rejected := range e.Rejected {
+			if err := e.setRow(file, taxExportErrorSheet, i+2, []interface{}{rejected.Line, rejected.Column, rejected.Message}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := file.Write(w); err != nil {
+		return fmt.Errorf("failed to write xlsx: %v", err)
+	}
+
+	return nil
+}
+
+func (e *TaxExport) setRow(file *excelize.File, sheet string, row int, values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, row)
+	if err != nil {
+		return fmt.Errorf("failed to write xlsx: %v", err)
+	}
+
+	if err := file.SetSheetRow(sheet, cell, &values); err != nil {
+		return fmt.Errorf("failed to write xlsx: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package taxUsecases
+
+import (
+	"bytes"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+	"testing"
+)
+
+func TestExportFormat(t *testing.T) {
+	testCases := []struct {
+		name        string
+		format      string
+		accept      string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "default json", expected: ExportFormatJSON},
+		{name: "format parameter", format: "XLSX", accept: MIMETextCSV, expected: ExportFormatXLSX},
+		{name: "accept header", accept: "application/json;q=0.9, text/csv", expected: ExportFormatCSV},
+		{name: "unknown format", format: "pdf", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ExportFormat(tc.format, tc.accept)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func mockTaxExport() TaxExport {
+	minimumTax := decimal.NewFromInt(7500)
+	return TaxExport{
+		Columns: []string{"reference", "totalIncome", "wht", "donation"},
+		Rows: []TaxExportRow{
+			{
+				Request:    &CalculateTaxRequest{Line: 2, Reference: "EMP-001", TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero},
+				Expense:    decimal.NewFromInt(100000),
+				Tax:        decimal.NewFromInt(29000),
+				TaxMethod:  tax.TaxMethodBracket,
+				BracketTax: decimal.NewFromInt(29000),
+				TaxLevels: []TaxLevelResponse{
+					{Level: "0-150000", Tax: decimal.Zero},
+					{Level: "150001-500000", Tax: decimal.NewFromInt(29000)},
+				},
+			},
+			{
+				Request: &CalculateTaxRequest{Line: 3, Reference: "EMP-002", TotalIncome: decimal.NewFromInt(600000), Wht: decimal.NewFromInt(40000), Allowances: []TaxAllowanceDetails{
+					{AllowanceType: "donation", Amount: decimal.NewFromInt(20000)},
+				}},
+				Expense:    decimal.NewFromInt(100000),
+				TaxRefund:  decimal.NewFromInt(2000),
+				TaxMethod:  tax.TaxMethodBracket,
+				BracketTax: decimal.NewFromInt(38000),
+				MinimumTax: &minimumTax,
+				TaxLevels: []TaxLevelResponse{
+					{Level: "0-150000", Tax: decimal.Zero},
+					{Level: "150001-500000", Tax: decimal.NewFromInt(35000)},
+					{Level: "500001-1000000", Tax: decimal.NewFromInt(3000)},
+				},
+			},
+		},
+		Rejected: []RowError{{Line: 4, Column: "wht", Message: "could not parse wht"}},
+	}
+}
+
+func TestTaxExport_WriteCSV(t *testing.T) {
+	export := mockTaxExport()
+
+	var buf bytes.Buffer
+	err := export.WriteCSV(&buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "line,reference,totalIncome,wht,donation,expense,tax,taxRefund,taxMethod,bracketTax,minimumTax,tax 0-150000,tax 150001-500000,tax 500001-1000000\n"+
+		"2,EMP-001,500000,0,,100000,29000,0,bracket,29000,,0,29000,0\n"+
+		"3,EMP-002,600000,40000,20000,100000,0,2000,bracket,38000,7500,0,35000,3000\n", buf.String())
+}
+
+func TestTaxExport_WriteXLSX(t *testing.T) {
+	export := mockTaxExport()
+
+	var buf bytes.Buffer
+	err := export.WriteXLSX(&buf)
+	assert.NoError(t, err)
+
+	file, err := excelize.OpenReader(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{taxExportSheet, taxExportErrorSheet}, file.GetSheetList())
+
+	rows, err := file.GetRows(taxExportSheet)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, []string{"3", "EMP-002", "600000", "40000", "20000", "100000", "0", "2000", "bracket", "38000", "7500", "0", "35000", "3000"}, rows[2])
+
+	rejected, err := file.GetRows(taxExportErrorSheet)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4", "wht", "could not parse wht"}, rejected[1])
+}
@@ -0,0 +1,246 @@
+package taxUsecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/Montheankul-K/assessment-tax/modules/tax/taxRepositories"
+	"github.com/Montheankul-K/assessment-tax/packages/worker"
+	"github.com/shopspring/decimal"
+	"log"
+	"sort"
+	"sync"
+)
+
+const taxJobChunkSize = 500
+
+type ITaxJobUsecase interface {
+	SubmitTaxJob(reqs []CalculateTaxRequest, rejected []RowError) (*TaxJobResponse, error)
+	GetTaxJob(id uint) (*TaxJobResponse, error)
+	GetTaxJobResult(id uint) ([]byte, error)
+	FailUnfinishedTaxJobs() error
+}
+
+type taxJobUsecase struct {
+	taxRepository taxRepositories.ITaxRepository
+	taxUsecase    ITaxUsecase
+	pool          worker.IPool
+}
+
+// taxJobRun is the state of a job that is shared by the chunks of rows running on the worker pool.
+type taxJobRun struct {
+	id        uint
+	requests  []CalculateTaxRequest
+	records   []TaxCalculationRecord
+	rejected  [][]RowError
+	uploaded  []RowError
+	mu        sync.Mutex
+	processed int
+	pending   int
+	err       error
+}
+
+func TaxJobUsecase(taxRepository taxRepositories.ITaxRepository, taxUsecase ITaxUsecase, pool worker.IPool) ITaxJobUsecase {
+	return &taxJobUsecase{
+		taxRepository: taxRepository,
+		taxUsecase:    taxUsecase,
+		pool:          pool,
+	}
+}
+
+func (u *taxJobUsecase) toTaxJobResponse(job *tax.TaxJob) *TaxJobResponse {
+	result := TaxJobResponse{
+		ID:            job.ID,
+		Status:        job.Status,
+		TotalRows:     job.TotalRows,
+		ProcessedRows: job.ProcessedRows,
+		Progress:      decimal.Zero,
+		Message:       job.Message,
+		CreatedAt:     job.CreatedAt,
+		UpdatedAt:     job.UpdatedAt,
+	}
+
+	if job.TotalRows > 0 {
+		result.Progress = decimal.NewFromInt(int64(job.ProcessedRows)).Mul(decimal.NewFromInt(100)).Div(decimal.NewFromInt(int64(job.TotalRows))).Round(2)
+	}
+
+	if job.Status == tax.TaxJobDone {
+		result.ResultUrl = fmt.Sprintf("/tax/jobs/%d/result", job.ID)
+	}
+
+	return &result
+}
+
+// SubmitTaxJob saves the job and returns right away, the rows are split into chunks that run on the worker pool.
+// The rows that were rejected while reading the upload are kept so they are reported in the result.
+func (u *taxJobUsecase) SubmitTaxJob(reqs []CalculateTaxRequest, rejected []RowError) (*TaxJobResponse, error) {
+	if len(reqs) == 0 {
+		return nil, tax.ErrTaxJobEmpty
+	}
+
+	job, err := u.taxRepository.CreateTaxJob(len(reqs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit tax job: %v", err)
+	}
+
+	run := &taxJobRun{
+		id:       job.ID,
+		requests: reqs,
+		records:  make([]TaxCalculationRecord, len(reqs)),
+		rejected: make([][]RowError, len(reqs)),
+		uploaded: rejected,
+		pending:  (len(reqs) + taxJobChunkSize - 1) / taxJobChunkSize,
+	}
+	go u.dispatch(run)
+
+	return u.toTaxJobResponse(job), nil
+}
+
+func (u *taxJobUsecase) dispatch(run *taxJobRun) {
+	for start := 0; start < len(run.requests); start += taxJobChunkSize {
+		end := min(start+taxJobChunkSize, len(run.requests))
+		if err := u.pool.Submit(func() { u.processChunk(run, start, end) }); err != nil {
+			for ; start < len(run.requests); start += taxJobChunkSize {
+				u.complete(run, 0, fmt.Errorf("failed to run tax job: %v", err))
+			}
+
+			return
+		}
+	}
+}
+
+func (run *taxJobRun) failed() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	return run.err != nil
+}
+
+// processChunk calculates the rows of a chunk, a row that can't be calculated is rejected without failing the job.
+func (u *taxJobUsecase) processChunk(run *taxJobRun, start, end int) {
+	for i := start; i < end && !run.failed(); i++ {
+		req := &run.requests[i]
+		if err := u.taxUsecase.ValidateCalculateTaxRequest(req); err != nil {
+			run.rejected[i] = []RowError{{Line: req.Line, Message: err.Error()}}
+			continue
+		}
+
+		record, err := u.taxUsecase.CalculateBulkTax(req, tax.CalculationSourceCSV)
+		if err != nil {
+			run.rejected[i] = []RowError{{Line: req.Line, Message: err.Error()}}
+			continue
+		}
+
+		run.records[i] = record
+	}
+
+	u.complete(run, end-start, nil)
+}
+
+// complete counts a finished chunk, the last chunk saves the result of the whole job.
+func (u *taxJobUsecase) complete(run *taxJobRun, rows int, err error) {
+	run.mu.Lock()
+	run.processed += rows
+	run.pending--
+	if run.err == nil {
+		run.err = err
+	}
+	processed, last, runErr := run.processed, run.pending == 0, run.err
+	run.mu.Unlock()
+
+	if err := u.taxRepository.SetTaxJobProgress(run.id, processed); err != nil {
+		log.Println("failed to update tax job progress: ", err)
+	}
+
+	if last {
+		u.finish(run, runErr)
+	}
+}
+
+func (u *taxJobUsecase) finish(run *taxJobRun, err error) {
+	var result *string
+	if err == nil {
+		result, err = u.saveResult(run)
+	}
+
+	status, message := tax.TaxJobDone, ""
+	if err != nil {
+		status, message = tax.TaxJobFailed, err.Error()
+	}
+
+	if err := u.taxRepository.FinishTaxJob(run.id, status, result, message); err != nil {
+		log.Println("failed to finish tax job: ", err)
+	}
+}
+
+// saveResult saves the calculated rows, the result lists them together with the rejected rows sorted by line.
+func (u *taxJobUsecase) saveResult(run *taxJobRun) (*string, error) {
+	rejected := run.uploaded
+	records := make([]TaxCalculationRecord, 0, len(run.records))
+	for i, record := range run.records {
+		if run.rejected[i] != nil {
+			rejected = append(rejected, run.rejected[i]...)
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	if _, err := u.taxUsecase.SaveTaxCalculations(records); err != nil {
+		return nil, err
+	}
+
+	results := NewRejectedTaxBulkResults(rejected)
+	for _, record := range records {
+		results = append(results, record.BulkResult())
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Row < results[j].Row
+	})
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tax job result: %v", err)
+	}
+
+	result := string(data)
+	return &result, nil
+}
+
+func (u *taxJobUsecase) GetTaxJob(id uint) (*TaxJobResponse, error) {
+	job, err := u.taxRepository.FindTaxJob(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax job: %w", err)
+	}
+
+	return u.toTaxJobResponse(job), nil
+}
+
+func (u *taxJobUsecase) GetTaxJobResult(id uint) ([]byte, error) {
+	job, err := u.taxRepository.FindTaxJob(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax job: %w", err)
+	}
+
+	if job.Status != tax.TaxJobDone || job.Result == nil {
+		return nil, fmt.Errorf("%w: %d is %s", tax.ErrTaxJobNotDone, id, job.Status)
+	}
+
+	return []byte(*job.Result), nil
+}
+
+// FailUnfinishedTaxJobs fails the jobs that were pending or running when the server stopped, their rows only lived in
+// memory so they can't be resumed.
+func (u *taxJobUsecase) FailUnfinishedTaxJobs() error {
+	count, err := u.taxRepository.FailUnfinishedTaxJobs("tax job was interrupted by a server restart")
+	if err != nil {
+		return fmt.Errorf("failed to fail unfinished tax jobs: %v", err)
+	}
+
+	if count > 0 {
+		log.Printf("failed %d unfinished tax jobs", count)
+	}
+
+	return nil
+}
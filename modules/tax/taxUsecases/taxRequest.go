@@ -1,16 +1,100 @@
 package taxUsecases
 
+import (
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
 type TaxAllowanceDetails struct {
-	AllowanceType string
-	Amount        float64
+	AllowanceType string          `json:"allowanceType"`
+	Amount        decimal.Decimal `json:"amount"`
+}
+
+// TaxIncomeDetails is an income of one income type, IncomeType is one of tax.IncomeTypes.
+type TaxIncomeDetails struct {
+	IncomeType string          `json:"incomeType"`
+	Amount     decimal.Decimal `json:"amount"`
+	Wht        decimal.Decimal `json:"wht"`
 }
 
 type CalculateTaxRequest struct {
-	TotalIncome float64
-	Wht         float64
-	Allowances  []TaxAllowanceDetails
+	Line        int                   `json:"-"`
+	Reference   string                `json:"reference,omitempty"`
+	TaxYear     int                   `json:"taxYear"`
+	EffectiveAt time.Time             `json:"effectiveAt"`
+	TotalIncome decimal.Decimal       `json:"totalIncome"`
+	Wht         decimal.Decimal       `json:"wht"`
+	Incomes     []TaxIncomeDetails    `json:"incomes,omitempty"`
+	Dividends   []TaxDividend         `json:"dividends,omitempty"`
+	Allowances  []TaxAllowanceDetails `json:"allowances"`
+	Dependents  *TaxDependents        `json:"dependents,omitempty"`
+	Taxpayer    *TaxTaxpayer          `json:"taxpayer,omitempty"`
+}
+
+// TaxCalculationRecord is a calculation that was returned to the user and has to be kept in the history.
+type TaxCalculationRecord struct {
+	Source    string
+	Request   *CalculateTaxRequest
+	Response  interface{}
+	TotalTax  decimal.Decimal
+	TaxRefund decimal.Decimal
+	Expense   decimal.Decimal
+	TaxLevels []TaxLevelResponse
+}
+
+type TaxCalculationFilter struct {
+	Source   string    `query:"source"`
+	TaxYear  int       `query:"taxYear"`
+	From     time.Time `query:"from"`
+	To       time.Time `query:"to"`
+	Page     int       `query:"page"`
+	PageSize int       `query:"pageSize"`
+}
+
+// ageInTaxYear returns the age at the end of the tax year of someone born on birthDate, birth dates are in the Gregorian
+// calendar and the tax year is in the Buddhist era.
+func ageInTaxYear(birthDate time.Time, taxYear int) int {
+	return taxYear - buddhistEraOffset - birthDate.Year()
 }
 
 func NewCalculateTaxRequest() *CalculateTaxRequest {
 	return &CalculateTaxRequest{}
 }
+
+func (r *CalculateTaxRequest) RuleFilter() tax.RuleFilter {
+	return tax.RuleFilter{
+		TaxYear:     r.TaxYear,
+		EffectiveAt: r.EffectiveAt,
+	}
+}
+
+// IncomeDetails returns the incomes of the request, a request without incomes has its total income as salary.
+// The dividends of the request are not included.
+func (r *CalculateTaxRequest) IncomeDetails() []TaxIncomeDetails {
+	if len(r.Incomes) > 0 {
+		return r.Incomes
+	}
+
+	if r.TotalIncome.IsZero() && len(r.Dividends) > 0 {
+		return nil
+	}
+
+	return []TaxIncomeDetails{{IncomeType: tax.IncomeTypeSalary, Amount: r.TotalIncome, Wht: r.Wht}}
+}
+
+// TotalWht returns the wht of the incomes and of the dividends.
+func (r *CalculateTaxRequest) TotalWht() decimal.Decimal {
+	result := r.Wht
+	for _, dividend := range r.Dividends {
+		result = result.Add(dividend.Wht)
+	}
+
+	return result
+}
+
+// BulkResult returns the response of a record that is calculated by CalculateBulkTax.
+func (r TaxCalculationRecord) BulkResult() TaxBulkResult {
+	result, _ := r.Response.(TaxBulkResult)
+	return result
+}
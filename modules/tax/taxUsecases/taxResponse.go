@@ -1,10 +1,18 @@
 package taxUsecases
 
-import "github.com/labstack/echo/v4"
+import (
+	"encoding/json"
+	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"sort"
+	"time"
+)
 
 type IResponse interface {
 	ResponseSuccess(statusCode int, data interface{}) error
 	ResponseError(statusCode int, errMsg string) error
+	ResponseRowErrors(statusCode int, errMsg string, rowErrors []RowError) error
 }
 
 type Response struct {
@@ -12,29 +20,120 @@ type Response struct {
 }
 
 type Error struct {
+	Message string     `json:"message"`
+	Errors  []RowError `json:"errors,omitempty"`
+}
+
+// RowError is a problem found in one row of an uploaded file, Line is the line number in the file.
+type RowError struct {
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
 	Message string `json:"message"`
 }
 
+type TaxIncomeResponse struct {
+	IncomeType string          `json:"incomeType"`
+	Amount     decimal.Decimal `json:"amount"`
+	Expense    decimal.Decimal `json:"expense"`
+}
+
+// TaxAllowanceDeduction explains how much of a claimed allowance was deducted.
+type TaxAllowanceDeduction struct {
+	AllowanceType string          `json:"allowanceType"`
+	Claimed       decimal.Decimal `json:"claimed"`
+	Allowed       decimal.Decimal `json:"allowed"`
+}
+
 type TaxResponse struct {
-	Tax      float64            `json:"tax"`
-	TaxLevel []TaxLevelResponse `json:"taxLevel"`
-	TotalTax float64            `json:"totalTax"`
+	Incomes             []TaxIncomeResponse     `json:"incomes,omitempty"`
+	Expense             decimal.Decimal         `json:"expense"`
+	Exemption           *decimal.Decimal        `json:"exemption,omitempty"`
+	TaxCredit           *decimal.Decimal        `json:"taxCredit,omitempty"`
+	DependentAllowances []TaxAllowanceDetails   `json:"dependentAllowances,omitempty"`
+	Allowances          []TaxAllowanceDeduction `json:"allowances,omitempty"`
+	Tax                 decimal.Decimal         `json:"tax"`
+	TaxMethod           string                  `json:"taxMethod"`
+	BracketTax          decimal.Decimal         `json:"bracketTax"`
+	MinimumTax          *decimal.Decimal        `json:"minimumTax,omitempty"`
+	TaxLevel            []TaxLevelResponse      `json:"taxLevel"`
+	TotalTax            decimal.Decimal         `json:"totalTax"`
 }
 
 type TaxResponseWithRefund struct {
 	TaxResponse
-	TaxRefund float64 `json:"taxRefund"`
+	TaxRefund decimal.Decimal `json:"taxRefund"`
+}
+
+// TaxBulkResult is the result of one row of a bulk calculation, it is used by the csv, ndjson and job endpoints.
+// Row is the line number of the row, Tax and TaxRefund are only set when the row is calculated.
+type TaxBulkResult struct {
+	Row        int                     `json:"row"`
+	Status     string                  `json:"status"`
+	Input      *CalculateTaxRequest    `json:"input,omitempty"`
+	Expense    *decimal.Decimal        `json:"expense,omitempty"`
+	Allowances []TaxAllowanceDeduction `json:"allowances,omitempty"`
+	TaxMethod  string                  `json:"taxMethod,omitempty"`
+	BracketTax *decimal.Decimal        `json:"bracketTax,omitempty"`
+	MinimumTax *decimal.Decimal        `json:"minimumTax,omitempty"`
+	Tax        *decimal.Decimal        `json:"tax,omitempty"`
+	TaxRefund  *decimal.Decimal        `json:"taxRefund,omitempty"`
+	Errors     []RowError              `json:"errors,omitempty"`
+}
+
+type TaxBulkResponse struct {
+	Taxes []TaxBulkResult `json:"taxes"`
+}
+
+type TaxCalculationResponse struct {
+	ID           uint            `json:"id"`
+	Source       string          `json:"source"`
+	TaxYear      int             `json:"taxYear"`
+	EffectiveAt  time.Time       `json:"effectiveAt"`
+	RoundingMode string          `json:"roundingMode"`
+	Request      json.RawMessage `json:"request"`
+	Response     json.RawMessage `json:"response"`
+	CreatedAt    time.Time       `json:"createdAt"`
 }
 
-type TaxCSVResponse struct {
-	TotalIncome float64 `json:"totalIncome"`
-	Tax         float64 `json:"tax"`
+type TaxCalculationListResponse struct {
+	TaxCalculations []TaxCalculationResponse `json:"taxCalculations"`
+	Page            int                      `json:"page"`
+	PageSize        int                      `json:"pageSize"`
+	Total           int64                    `json:"total"`
 }
 
-type TaxCSVResponseWithRefund struct {
-	TotalIncome float64 `json:"totalIncome"`
-	Tax         float64 `json:"tax"`
-	TaxRefund   float64 `json:"taxRefund"`
+type TaxJobResponse struct {
+	ID            uint            `json:"id"`
+	Status        string          `json:"status"`
+	TotalRows     int             `json:"totalRows"`
+	ProcessedRows int             `json:"processedRows"`
+	Progress      decimal.Decimal `json:"progress"`
+	Message       string          `json:"message,omitempty"`
+	ResultUrl     string          `json:"resultUrl,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+}
+
+// NewRejectedTaxBulkResults groups the errors by line, the results are sorted by line.
+func NewRejectedTaxBulkResults(rowErrors []RowError) []TaxBulkResult {
+	var results []TaxBulkResult
+	index := make(map[int]int)
+	for _, rowError := range rowErrors {
+		i, ok := index[rowError.Line]
+		if !ok {
+			i = len(results)
+			index[rowError.Line] = i
+			results = append(results, TaxBulkResult{Row: rowError.Line, Status: tax.BulkResultRejected})
+		}
+
+		results[i].Errors = append(results[i].Errors, rowError)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Row < results[j].Row
+	})
+
+	return results
 }
 
 func NewResponse(c echo.Context) IResponse {
@@ -52,3 +151,10 @@ func (r *Response) ResponseError(statusCode int, errMessage string) error {
 		Message: errMessage,
 	})
 }
+
+func (r *Response) ResponseRowErrors(statusCode int, errMessage string, rowErrors []RowError) error {
+	return r.Context.JSON(statusCode, &Error{
+		Message: errMessage,
+		Errors:  rowErrors,
+	})
+}
@@ -1,217 +1,1114 @@
 package taxUsecases
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
 	"github.com/Montheankul-K/assessment-tax/modules/tax/taxRepositories"
-	"math"
+	"github.com/Montheankul-K/assessment-tax/packages/money"
+	"github.com/shopspring/decimal"
+	"sort"
+	"time"
 )
 
+const buddhistEraOffset = 543
+
 type ITaxUsecase interface {
-	FindBaseline(allowanceType string) (float64, float64, error)
-	FindTaxPercent(totalIncome float64) (float64, error)
-	FindMaxIncomeAndPercent() (float64, float64, error)
-	CalculateTaxByTaxLevel(income float64) (float64, error)
-	GetTaxLevel() ([]EachTaxLevel, error)
-	SetDeduction(req *tax.SetNewDeductionAmount) (float64, error)
-	DecreasePersonalAllowance(totalIncome float64) (float64, error)
-	DecreaseWHT(tax, wht float64) float64
-	DecreaseAllowance(tax float64, allowances []TaxAllowanceDetails) float64
-	ConstructTaxLevels(maxIncomeAmount float64, taxLevels []tax.TaxLevel) []EachTaxLevel
-	SetValueToTaxLevel(taxLevels []EachTaxLevel, tax float64) ([]TaxLevelResponse, error)
-	GetTaxLevelDetails(tax float64) ([]TaxLevelResponse, error)
-	CalculateTaxWithoutWHT(req *CalculateTaxRequest) (float64, error)
+	ResolveTaxYear(taxYear int) (int, error)
+	FindBaseline(allowanceType string, rule tax.RuleFilter) (decimal.Decimal, decimal.Decimal, error)
+	FindAllowance(allowanceType string, rule tax.RuleFilter) (*tax.TaxAllowance, error)
+	CalculateTaxByTaxLevel(income decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, []EachTaxLevel, error)
+	WalkTaxLevels(income decimal.Decimal, taxLevels []EachTaxLevel) (decimal.Decimal, []EachTaxLevel)
+	GetTaxLevel(rule tax.RuleFilter) ([]EachTaxLevel, error)
+	ListTaxLevels(rule tax.RuleFilter) ([]tax.TaxLevel, error)
+	CreateTaxLevel(req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error)
+	UpdateTaxLevel(id uint, req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error)
+	DeleteTaxLevel(id uint, effectiveFrom time.Time) ([]tax.TaxLevel, error)
+	SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error)
+	ValidateTaxLevels(taxLevels []tax.TaxLevel) error
+	SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error)
+	ListTaxExpenses(rule tax.RuleFilter) ([]tax.TaxExpense, error)
+	SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error)
+	CalculateExpense(income decimal.Decimal, incomeType string, rule tax.RuleFilter) (decimal.Decimal, error)
+	GetMinimumTax(rule tax.RuleFilter) (*tax.TaxMinimumTax, error)
+	SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error)
+	CalculateMinimumTax(incomes []TaxIncomeResponse, taxCredit decimal.Decimal, rule tax.RuleFilter) (*decimal.Decimal, error)
+	GetDependentRule(rule tax.RuleFilter) (*tax.TaxDependentRule, error)
+	SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error)
+	FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error)
+	ListAllowanceTypes() ([]tax.TaxAllowanceType, error)
+	CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error)
+	DisableAllowanceType(req *tax.DisableAllowance) error
+	DecreaseAutomaticAllowances(totalIncome decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, error)
+	DecreaseWHT(tax, wht, taxCredit decimal.Decimal) decimal.Decimal
+	ValidateAllowance(allowance TaxAllowanceDetails, rule tax.RuleFilter) error
+	DecreaseAllowance(income decimal.Decimal, req *CalculateTaxRequest) (decimal.Decimal, []TaxAllowanceDeduction, error)
+	ConstructTaxLevels(taxLevels []tax.TaxLevel) []EachTaxLevel
+	SetValueToTaxLevel(taxLevels []EachTaxLevel) []TaxLevelResponse
+	ValidateCalculateTaxRequest(req *CalculateTaxRequest) error
+	ValidateCalculateTaxRequestFields(req *CalculateTaxRequest) []RowError
+	ValidateDependents(req *CalculateTaxRequest) error
+	DependentAllowances(req *CalculateTaxRequest) ([]TaxAllowanceDetails, error)
+	IncomeExemption(req *CalculateTaxRequest) (decimal.Decimal, error)
+	CalculateTaxWithoutWHT(req *CalculateTaxRequest) (*TaxResult, error)
+	CalculateBulkTax(req *CalculateTaxRequest, source string) (TaxCalculationRecord, error)
+	SaveTaxCalculations(records []TaxCalculationRecord) ([]tax.TaxCalculation, error)
+	GetTaxCalculation(id uint) (*TaxCalculationResponse, error)
+	ListTaxCalculations(req *TaxCalculationFilter) (*TaxCalculationListResponse, error)
 }
 
 type taxUsecase struct {
 	taxRepository taxRepositories.ITaxRepository
+	rounding      money.IRounding
 }
 
 type TaxLevelResponse struct {
-	Level string  `json:"level"`
-	Tax   float64 `json:"tax"`
+	Level         string          `json:"level"`
+	TaxableIncome decimal.Decimal `json:"taxableIncome"`
+	TaxPercent    decimal.Decimal `json:"taxPercent"`
+	Tax           decimal.Decimal `json:"tax"`
+}
+
+// TaxResult is the tax before wht together with the amounts that were deducted to get the taxable income.
+// Tax is the higher of BracketTax and MinimumTax, Method tells which one it is.
+type TaxResult struct {
+	Tax                 decimal.Decimal
+	Method              string
+	BracketTax          decimal.Decimal
+	MinimumTax          *decimal.Decimal
+	TaxLevels           []EachTaxLevel
+	Incomes             []TaxIncomeResponse
+	Expense             decimal.Decimal
+	Exemption           decimal.Decimal
+	TaxCredit           decimal.Decimal
+	DependentAllowances []TaxAllowanceDetails
+	Allowances          []TaxAllowanceDeduction
 }
 
-func TaxUsecase(taxRepository taxRepositories.ITaxRepository) ITaxUsecase {
+func TaxUsecase(taxRepository taxRepositories.ITaxRepository, rounding money.IRounding) ITaxUsecase {
 	return &taxUsecase{
 		taxRepository: taxRepository,
+		rounding:      rounding,
 	}
 }
 
-func (u *taxUsecase) FindBaseline(allowanceType string) (float64, float64, error) {
-	req := tax.AllowanceFilter{
-		AllowanceType: allowanceType,
+// ResolveTaxYear falls back to the latest tax year that is not after the current year when taxYear is zero.
+func (u *taxUsecase) ResolveTaxYear(taxYear int) (int, error) {
+	taxYears, err := u.taxRepository.FindTaxYears()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find tax years: %v", err)
 	}
 
-	minAllowanceAmount, maxAllowanceAmount, err := u.taxRepository.FindBaselineAllowanceAmount(&req)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to find baseline allowance: %v", err)
+	if taxYear == 0 {
+		currentTaxYear := time.Now().Year() + buddhistEraOffset
+		for _, year := range taxYears {
+			if year <= currentTaxYear {
+				taxYear = year
+			}
+		}
+
+		if taxYear == 0 {
+			return 0, fmt.Errorf("tax rules for tax year %d not found", currentTaxYear)
+		}
+
+		return taxYear, nil
 	}
 
-	return minAllowanceAmount, maxAllowanceAmount, nil
+	for _, year := range taxYears {
+		if year == taxYear {
+			return taxYear, nil
+		}
+	}
+
+	return 0, fmt.Errorf("tax rules for tax year %d not found", taxYear)
 }
 
-func (u *taxUsecase) FindTaxPercent(totalIncome float64) (float64, error) {
-	req := tax.TaxLevelFilter{
-		Income: totalIncome,
+func (u *taxUsecase) FindBaseline(allowanceType string, rule tax.RuleFilter) (decimal.Decimal, decimal.Decimal, error) {
+	req := tax.AllowanceFilter{
+		AllowanceType: allowanceType,
+		RuleFilter:    rule,
 	}
 
-	taxPercent, err := u.taxRepository.FindTaxPercentByIncome(&req)
+	minAllowanceAmount, maxAllowanceAmount, err := u.taxRepository.FindBaselineAllowanceAmount(&req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to find tax percent: %v", err)
+		return decimal.Zero, decimal.Zero, fmt.Errorf("failed to find baseline allowance: %v", err)
 	}
 
-	return taxPercent, nil
+	return minAllowanceAmount, maxAllowanceAmount, nil
 }
 
-func (u *taxUsecase) FindMaxIncomeAndPercent() (float64, float64, error) {
-	maxIncome, taxPercent, err := u.taxRepository.FindMaxIncomeAndPercent()
+// FindAllowance returns the version of the allowance that is effective by the rule, it tells whether the allowance type
+// is enabled and its group in that version.
+func (u *taxUsecase) FindAllowance(allowanceType string, rule tax.RuleFilter) (*tax.TaxAllowance, error) {
+	result, err := u.taxRepository.FindAllowance(&tax.AllowanceFilter{AllowanceType: allowanceType, RuleFilter: rule})
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to find max income and percent: %v", err)
+		return nil, fmt.Errorf("failed to find baseline allowance: %v", err)
 	}
 
-	return maxIncome, taxPercent, nil
+	return result, nil
 }
 
 type EachTaxLevel struct {
-	MinMax []float64
-	Level  string
-	Tax    float64
+	MinIncome     decimal.Decimal
+	MaxIncome     *decimal.Decimal
+	Level         string
+	TaxPercent    decimal.Decimal
+	TaxableIncome decimal.Decimal
+	Tax           decimal.Decimal
 }
 
-func (u *taxUsecase) ConstructTaxLevels(maxIncomeAmount float64, taxLevels []tax.TaxLevel) []EachTaxLevel {
+func (u *taxUsecase) ConstructTaxLevels(taxLevels []tax.TaxLevel) []EachTaxLevel {
 	newTaxLevel := make([]EachTaxLevel, 0, len(taxLevels))
 	for _, level := range taxLevels {
 		var levelDesc string
-		if level.MinIncome == maxIncomeAmount {
-			levelDesc = fmt.Sprintf("%d ขึ้นไป", int(level.MinIncome))
+		if level.IsOpenEnded() {
+			levelDesc = fmt.Sprintf("%d ขึ้นไป", level.MinIncome.IntPart())
 		} else {
-			levelDesc = fmt.Sprintf("%d-%d", int(level.MinIncome), int(level.MaxIncome))
+			levelDesc = fmt.Sprintf("%d-%d", level.MinIncome.IntPart(), level.MaxIncome.IntPart())
 		}
 
 		newTaxLevel = append(newTaxLevel, EachTaxLevel{
-			MinMax: []float64{level.MinIncome, level.MaxIncome},
-			Level:  levelDesc,
-			Tax:    0.0,
+			MinIncome:  level.MinIncome,
+			MaxIncome:  level.MaxIncome,
+			Level:      levelDesc,
+			TaxPercent: level.TaxPercent,
+			Tax:        decimal.Zero,
 		})
 	}
 
+	sort.SliceStable(newTaxLevel, func(i, j int) bool {
+		return newTaxLevel[i].MinIncome.LessThan(newTaxLevel[j].MinIncome)
+	})
+
 	return newTaxLevel
 }
 
-func (u *taxUsecase) GetTaxLevel() ([]EachTaxLevel, error) {
-	maxIncomeAmount, _, err := u.FindMaxIncomeAndPercent()
+func (u *taxUsecase) GetTaxLevel(rule tax.RuleFilter) ([]EachTaxLevel, error) {
+	taxLevels, err := u.taxRepository.GetTaxLevel(&rule)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get max income and percent: %v", err)
+		return nil, fmt.Errorf("failed to get tax level: %v", err)
 	}
 
-	taxLevels, err := u.taxRepository.GetTaxLevel()
+	if len(taxLevels) == 0 {
+		return nil, fmt.Errorf("tax level for %d not found", rule.TaxYear)
+	}
+
+	return u.ConstructTaxLevels(taxLevels), nil
+}
+
+func (u *taxUsecase) ListTaxLevels(rule tax.RuleFilter) ([]tax.TaxLevel, error) {
+	taxLevels, err := u.taxRepository.GetTaxLevel(&rule)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tax level: %v", err)
+		return nil, fmt.Errorf("failed to list tax level: %v", err)
+	}
+
+	return taxLevels, nil
+}
+
+func (u *taxUsecase) CreateTaxLevel(req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	taxLevels, err := u.ListTaxLevels(tax.RuleFilter{TaxYear: req.TaxYear, EffectiveAt: req.EffectiveFrom})
+	if err != nil {
+		return nil, err
+	}
+
+	taxLevels = append(taxLevels, tax.TaxLevel{
+		MinIncome:  req.MinIncome,
+		MaxIncome:  req.MaxIncome,
+		TaxPercent: req.TaxPercent,
+	})
+
+	return u.SetTaxLevels(&tax.SetNewTaxLevels{
+		TaxYear:       req.TaxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		TaxLevels:     taxLevels,
+	})
+}
+
+// findTaxLevelVersion returns the version of tax levels effective at effectiveFrom that contains the tax level id.
+func (u *taxUsecase) findTaxLevelVersion(id uint, effectiveFrom time.Time) (int, []tax.TaxLevel, int, error) {
+	taxLevel, err := u.taxRepository.FindTaxLevelByID(id)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("failed to find tax level: %w", err)
+	}
+
+	taxLevels, err := u.ListTaxLevels(tax.RuleFilter{TaxYear: taxLevel.TaxYear, EffectiveAt: effectiveFrom})
+	if err != nil {
+		return 0, nil, 0, err
+	}
+
+	for i, level := range taxLevels {
+		if level.ID == id {
+			return taxLevel.TaxYear, taxLevels, i, nil
+		}
+	}
+
+	return 0, nil, 0, fmt.Errorf("%w: %d is not effective at %s", tax.ErrTaxLevelNotFound, id, effectiveFrom.Format(time.RFC3339))
+}
+
+func (u *taxUsecase) UpdateTaxLevel(id uint, req *tax.SetNewTaxLevel) ([]tax.TaxLevel, error) {
+	taxYear, taxLevels, index, err := u.findTaxLevelVersion(id, req.EffectiveFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	taxLevels[index].MinIncome = req.MinIncome
+	taxLevels[index].MaxIncome = req.MaxIncome
+	taxLevels[index].TaxPercent = req.TaxPercent
+
+	return u.SetTaxLevels(&tax.SetNewTaxLevels{
+		TaxYear:       taxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		TaxLevels:     taxLevels,
+	})
+}
+
+// DeleteTaxLevel removes a tax level from a new version, the level below takes over the income of the removed level
+// so the levels stay contiguous. When the first level is removed the level above it starts where the removed one did.
+func (u *taxUsecase) DeleteTaxLevel(id uint, effectiveFrom time.Time) ([]tax.TaxLevel, error) {
+	taxYear, taxLevels, index, err := u.findTaxLevelVersion(id, effectiveFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	if index > 0 {
+		taxLevels[index-1].MaxIncome = taxLevels[index].MaxIncome
+	} else if index+1 < len(taxLevels) {
+		taxLevels[index+1].MinIncome = taxLevels[index].MinIncome
+	}
+
+	return u.SetTaxLevels(&tax.SetNewTaxLevels{
+		TaxYear:       taxYear,
+		EffectiveFrom: effectiveFrom,
+		TaxLevels:     append(taxLevels[:index], taxLevels[index+1:]...),
+	})
+}
+
+// sortTaxLevels returns a copy of the tax levels ordered by min income.
+func sortTaxLevels(taxLevels []tax.TaxLevel) []tax.TaxLevel {
+	result := make([]tax.TaxLevel, len(taxLevels))
+	copy(result, taxLevels)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].MinIncome.LessThan(result[j].MinIncome)
+	})
+
+	return result
+}
+
+// SetTaxLevels validates the whole set of tax levels before it is saved, so a bad write never reaches the database.
+// The levels are saved in the order of their min income.
+func (u *taxUsecase) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
+	if err := u.ValidateTaxLevels(req.TaxLevels); err != nil {
+		return nil, err
+	}
+
+	result, err := u.taxRepository.SetTaxLevels(&tax.SetNewTaxLevels{
+		TaxYear:       req.TaxYear,
+		EffectiveFrom: req.EffectiveFrom,
+		TaxLevels:     sortTaxLevels(req.TaxLevels),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set tax level: %w", err)
+	}
+
+	return result, nil
+}
+
+// ValidateTaxLevels checks the tax levels in the order of their min income without reordering the given slice,
+// the first level must start at zero and each next level must start right after the previous one ends.
+func (u *taxUsecase) ValidateTaxLevels(taxLevels []tax.TaxLevel) error {
+	if len(taxLevels) == 0 {
+		return fmt.Errorf("%w: at least one tax level is required", tax.ErrInvalidTaxLevels)
+	}
+
+	taxLevels = sortTaxLevels(taxLevels)
+
+	hundred, oneBaht := decimal.NewFromInt(100), decimal.NewFromInt(1)
+	for i, level := range taxLevels {
+		if level.TaxPercent.IsNegative() || level.TaxPercent.GreaterThan(hundred) {
+			return fmt.Errorf("%w: tax percent must be between 0 and 100", tax.ErrInvalidTaxLevels)
+		}
+
+		if level.MaxIncome != nil && level.MaxIncome.LessThanOrEqual(level.MinIncome) {
+			return fmt.Errorf("%w: max income must be greater than min income", tax.ErrInvalidTaxLevels)
+		}
+
+		if i == 0 {
+			if !level.MinIncome.IsZero() {
+				return fmt.Errorf("%w: first tax level must start at 0", tax.ErrInvalidTaxLevels)
+			}
+
+			continue
+		}
+
+		previous := taxLevels[i-1]
+		if previous.IsOpenEnded() {
+			return fmt.Errorf("%w: only the last tax level can be open-ended", tax.ErrInvalidTaxLevels)
+		}
+
+		gap := level.MinIncome.Sub(*previous.MaxIncome)
+		if !gap.IsPositive() {
+			return fmt.Errorf("%w: tax level starting at %s overlaps the previous level", tax.ErrInvalidTaxLevels, level.MinIncome.StringFixed(2))
+		}
+
+		if gap.GreaterThan(oneBaht) {
+			return fmt.Errorf("%w: tax level starting at %s is not contiguous with the previous level", tax.ErrInvalidTaxLevels, level.MinIncome.StringFixed(2))
+		}
+	}
+
+	// income above a bounded last level would not be taxed at all
+	if !taxLevels[len(taxLevels)-1].IsOpenEnded() {
+		return fmt.Errorf("%w: last tax level must be open-ended", tax.ErrInvalidTaxLevels)
 	}
 
-	return u.ConstructTaxLevels(maxIncomeAmount, taxLevels), nil
+	return nil
 }
 
-func (u *taxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (float64, error) {
+func (u *taxUsecase) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	if _, err := u.FindAllowanceType(req.AllowanceType); err != nil {
+		return decimal.Zero, err
+	}
+
+	allowance, err := u.FindAllowance(req.AllowanceType, tax.RuleFilter{TaxYear: req.TaxYear, EffectiveAt: req.EffectiveFrom})
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if !allowance.Enabled {
+		return decimal.Zero, fmt.Errorf("%w: %s is disabled", tax.ErrAllowanceTypeUnavailable, req.AllowanceType)
+	}
+
 	result, err := u.taxRepository.SetDeduction(req)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	return result, nil
 }
 
-func (u *taxUsecase) DecreasePersonalAllowance(totalIncome float64) (float64, error) {
-	_, maxAllowanceAmount, err := u.FindBaseline("personal")
+func (u *taxUsecase) ListTaxExpenses(rule tax.RuleFilter) ([]tax.TaxExpense, error) {
+	result, err := u.taxRepository.FindTaxExpenses(&rule)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decrease personal allowance")
+		return nil, fmt.Errorf("failed to list tax expenses: %v", err)
 	}
 
-	return totalIncome - maxAllowanceAmount, nil
+	return result, nil
 }
 
-func (u *taxUsecase) DecreaseWHT(tax, wht float64) float64 {
-	return tax - wht
+func (u *taxUsecase) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	result, err := u.taxRepository.SetTaxExpense(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set tax expense: %v", err)
+	}
+
+	return result, nil
 }
 
-func (u *taxUsecase) DecreaseAllowance(tax float64, allowances []TaxAllowanceDetails) float64 {
-	result := tax
-	for _, allowance := range allowances {
-		result -= allowance.Amount
+// CalculateExpense returns the expense deduction of the income, an income type without an expense deduction has none.
+func (u *taxUsecase) CalculateExpense(income decimal.Decimal, incomeType string, rule tax.RuleFilter) (decimal.Decimal, error) {
+	taxExpense, err := u.taxRepository.FindTaxExpense(&tax.ExpenseFilter{IncomeType: incomeType, RuleFilter: rule})
+	if err != nil {
+		if errors.Is(err, tax.ErrTaxExpenseNotFound) {
+			return decimal.Zero, nil
+		}
+
+		return decimal.Zero, fmt.Errorf("failed to calculate %s expense: %v", incomeType, err)
 	}
 
-	return result
+	result := u.rounding.Round(income.Mul(taxExpense.ExpensePercent).Div(decimal.NewFromInt(100)))
+	if taxExpense.MaxExpenseAmount != nil {
+		result = decimal.Min(result, *taxExpense.MaxExpenseAmount)
+	}
+
+	return decimal.Max(decimal.Zero, result), nil
 }
 
-func (u *taxUsecase) CalculateTaxByTaxLevel(income float64) (float64, error) {
-	maxIncome, maxPercent, err := u.FindMaxIncomeAndPercent()
+func (u *taxUsecase) GetMinimumTax(rule tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	result, err := u.taxRepository.FindMinimumTax(&rule)
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate tax: %v", err)
+		return nil, fmt.Errorf("failed to get minimum tax: %w", err)
 	}
 
-	if income > maxIncome {
-		return income * (maxPercent / 100), nil
+	return result, nil
+}
+
+func (u *taxUsecase) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	result, err := u.taxRepository.SetMinimumTax(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set minimum tax: %v", err)
 	}
 
-	taxPercent, err := u.FindTaxPercent(income)
+	return result, nil
+}
+
+// CalculateMinimumTax returns the tax on the gross income that is not salary, it returns nil when the tax year has no
+// minimum tax, when that income is below the min income or when the tax is waived. The tax credit of the dividends is
+// taken out of the income, the minimum tax is on the dividends that were received and not on their gross up.
+func (u *taxUsecase) CalculateMinimumTax(incomes []TaxIncomeResponse, taxCredit decimal.Decimal, rule tax.RuleFilter) (*decimal.Decimal, error) {
+	minimumTax, err := u.taxRepository.FindMinimumTax(&rule)
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate tax: %v", err)
+		if errors.Is(err, tax.ErrMinimumTaxNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to calculate minimum tax: %v", err)
+	}
+
+	income := decimal.Zero
+	for _, each := range incomes {
+		if tax.IsMinimumTaxIncome(each.IncomeType) {
+			income = income.Add(each.Amount)
+		}
+	}
+	income = income.Sub(taxCredit)
+
+	if income.IsZero() || income.LessThan(minimumTax.MinIncome) {
+		return nil, nil
+	}
+
+	result := u.rounding.Round(income.Mul(minimumTax.TaxPercent).Div(decimal.NewFromInt(100)))
+	if result.LessThanOrEqual(minimumTax.MaxExemptTax) {
+		return nil, nil
 	}
 
-	return income * (taxPercent / 100), nil
+	return &result, nil
 }
 
-func (u *taxUsecase) SetValueToTaxLevel(taxLevels []EachTaxLevel, tax float64) ([]TaxLevelResponse, error) {
-	result := make([]TaxLevelResponse, 0, len(taxLevels))
+func (u *taxUsecase) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	result, err := u.taxRepository.FindAllowanceType(allowanceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find allowance type: %w", err)
+	}
 
-	for _, level := range taxLevels {
-		levelMinIncome, levelMaxIncome := level.MinMax[0], level.MinMax[1]
-		if tax >= levelMinIncome && tax <= levelMaxIncome || levelMinIncome == levelMaxIncome && tax >= levelMaxIncome {
-			result = append(result, TaxLevelResponse{
-				Level: level.Level,
-				Tax:   tax,
-			})
+	return result, nil
+}
+
+func (u *taxUsecase) ListAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	result, err := u.taxRepository.FindAllowanceTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list allowance types: %v", err)
+	}
+
+	return result, nil
+}
+
+func (u *taxUsecase) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	result, err := u.taxRepository.CreateAllowanceType(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create allowance type: %w", err)
+	}
+
+	return result, nil
+}
+
+func (u *taxUsecase) DisableAllowanceType(req *tax.DisableAllowance) error {
+	if _, err := u.FindAllowanceType(req.AllowanceType); err != nil {
+		return err
+	}
+
+	if err := u.taxRepository.DisableAllowanceType(req); err != nil {
+		return fmt.Errorf("failed to disable allowance type: %w", err)
+	}
+
+	return nil
+}
+
+// DecreaseAutomaticAllowances deducts the max amount of every enabled allowance that is not supplied by the user, such as personal.
+func (u *taxUsecase) DecreaseAutomaticAllowances(totalIncome decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, error) {
+	allowanceTypes, err := u.ListAllowanceTypes()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	result := totalIncome
+	for _, allowanceType := range allowanceTypes {
+		if !allowanceType.IsAutomatic() {
 			continue
 		}
 
-		result = append(result, TaxLevelResponse{
-			Level: level.Level,
-			Tax:   level.Tax,
-		})
+		allowance, err := u.FindAllowance(allowanceType.AllowanceType, rule)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("failed to decrease %s allowance", allowanceType.AllowanceType)
+		}
+		if !allowance.Enabled {
+			continue
+		}
+
+		result = result.Sub(allowance.MaxAllowanceAmount)
 	}
 
 	return result, nil
 }
 
-func (u *taxUsecase) GetTaxLevelDetails(tax float64) ([]TaxLevelResponse, error) {
-	taxLevel, err := u.GetTaxLevel()
+// DecreaseWHT rounds the tax left after wht and the dividend tax credit, this is the last rounding step after the tax
+// of each level.
+func (u *taxUsecase) DecreaseWHT(tax, wht, taxCredit decimal.Decimal) decimal.Decimal {
+	return u.rounding.Round(tax.Sub(wht).Sub(taxCredit))
+}
+
+// findAllowanceRule looks up the rule registered for the allowance type, then the one for its validation method.
+func (u *taxUsecase) findAllowanceRule(allowanceType string, rule tax.RuleFilter) (IAllowanceRule, AllowanceBaseline, error) {
+	result, err := u.FindAllowanceType(allowanceType)
+	if err != nil {
+		return nil, AllowanceBaseline{}, err
+	}
+
+	if !result.IsUserSupplied() {
+		return nil, AllowanceBaseline{}, fmt.Errorf("%s allowance can't be supplied", allowanceType)
+	}
+
+	allowanceRule, ok := FindAllowanceRule(result.AllowanceType, result.ValidationMethod)
+	if !ok {
+		return nil, AllowanceBaseline{}, fmt.Errorf("allowance rule for %s not found", allowanceType)
+	}
+
+	taxAllowance, err := u.FindAllowance(allowanceType, rule)
+	if err != nil {
+		return nil, AllowanceBaseline{}, err
+	}
+
+	if !taxAllowance.Enabled {
+		return nil, AllowanceBaseline{}, fmt.Errorf("%s allowance is disabled in tax year %d", allowanceType, rule.TaxYear)
+	}
+
+	multiplier := decimal.NewFromInt(1)
+	if taxAllowance.DeductionMultiplier != nil {
+		multiplier = *taxAllowance.DeductionMultiplier
+	}
+
+	return allowanceRule, AllowanceBaseline{
+		MinAmount:        taxAllowance.MinAllowanceAmount,
+		MaxAmount:        taxAllowance.MaxAllowanceAmount,
+		MaxIncomePercent: taxAllowance.MaxIncomePercent,
+		IncomeType:       taxAllowance.IncomeType,
+		AllowanceGroup:   taxAllowance.AllowanceGroup,
+		Multiplier:       multiplier,
+	}, nil
+}
+
+func (u *taxUsecase) ValidateAllowance(allowance TaxAllowanceDetails, rule tax.RuleFilter) error {
+	allowanceRule, baseline, err := u.findAllowanceRule(allowance.AllowanceType, rule)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tax level")
+		return err
 	}
 
-	result, err := u.SetValueToTaxLevel(taxLevel, tax)
+	return allowanceRule.Validate(allowance, baseline)
+}
+
+// incomeOf returns the income of the income type, an empty income type is the total income.
+func (u *taxUsecase) incomeOf(req *CalculateTaxRequest, incomeType string) decimal.Decimal {
+	result := decimal.Zero
+	for _, income := range u.incomeDetails(req) {
+		if incomeType == "" || income.IncomeType == incomeType {
+			result = result.Add(income.Amount)
+		}
+	}
+
+	return result
+}
+
+// findAllowanceGroup returns nil when the allowance type has no group or the group has no limit.
+func (u *taxUsecase) findAllowanceGroup(allowanceGroup string, rule tax.RuleFilter) (*tax.TaxAllowanceGroup, error) {
+	if allowanceGroup == "" {
+		return nil, nil
+	}
+
+	result, err := u.taxRepository.FindAllowanceGroup(&tax.AllowanceGroupFilter{AllowanceGroup: allowanceGroup, RuleFilter: rule})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tax level")
+		if errors.Is(err, tax.ErrAllowanceGroupNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to find %s allowance group: %v", allowanceGroup, err)
 	}
 
 	return result, nil
 }
 
-func (u *taxUsecase) CalculateTaxWithoutWHT(req *CalculateTaxRequest) (float64, error) {
-	result, err := u.DecreasePersonalAllowance(req.TotalIncome)
+// allowanceGroupLeft returns what the group can still deduct from the net income, nil when the group has no limit.
+func (u *taxUsecase) allowanceGroupLeft(group *tax.TaxAllowanceGroup, netIncome decimal.Decimal) *decimal.Decimal {
+	var result *decimal.Decimal
+	if group.MaxAmount != nil {
+		maxAmount := *group.MaxAmount
+		result = &maxAmount
+	}
+
+	if group.MaxNetIncomePercent != nil {
+		maxAmount := u.rounding.Round(decimal.Max(decimal.Zero, netIncome).Mul(*group.MaxNetIncomePercent).Div(decimal.NewFromInt(100)))
+		if result == nil || maxAmount.LessThan(*result) {
+			result = &maxAmount
+		}
+	}
+
+	return result
+}
+
+// DecreaseAllowance deducts each allowance by its rule, a rule gets the income that is left after the previous allowances.
+// The amount of the rule is then limited to the percent of income of the allowance and to what is left of the max amount
+// of its group, so the allowances of a group are allowed in the order of the request. The allowances of a group that is
+// limited to a percent of net income, such as donations, are deducted after all the other allowances.
+func (u *taxUsecase) DecreaseAllowance(income decimal.Decimal, req *CalculateTaxRequest) (decimal.Decimal, []TaxAllowanceDeduction, error) {
+	rules := make([]IAllowanceRule, len(req.Allowances))
+	baselines := make([]AllowanceBaseline, len(req.Allowances))
+	groups := make(map[string]*tax.TaxAllowanceGroup)
+	var order, last []int
+	for i, allowance := range req.Allowances {
+		allowanceRule, baseline, err := u.findAllowanceRule(allowance.AllowanceType, req.RuleFilter())
+		if err != nil {
+			return decimal.Zero, nil, fmt.Errorf("failed to decrease allowance: %v", err)
+		}
+		rules[i], baselines[i] = allowanceRule, baseline
+
+		group, ok := groups[baseline.AllowanceGroup]
+		if !ok {
+			if group, err = u.findAllowanceGroup(baseline.AllowanceGroup, req.RuleFilter()); err != nil {
+				return decimal.Zero, nil, err
+			}
+			groups[baseline.AllowanceGroup] = group
+		}
+
+		if group != nil && group.MaxNetIncomePercent != nil {
+			last = append(last, i)
+			continue
+		}
+		order = append(order, i)
+	}
+
+	result := income
+	deductions := make([]TaxAllowanceDeduction, len(req.Allowances))
+	groupsLeft := make(map[string]*decimal.Decimal)
+	for _, i := range append(order, last...) {
+		allowance, baseline := req.Allowances[i], baselines[i]
+		allowed := rules[i].Deduct(allowance, baseline, result)
+		if baseline.MaxIncomePercent != nil {
+			maxAmount := u.rounding.Round(u.incomeOf(req, baseline.IncomeType).Mul(*baseline.MaxIncomePercent).Div(decimal.NewFromInt(100)))
+			allowed = decimal.Min(allowed, maxAmount)
+		}
+
+		if group := groups[baseline.AllowanceGroup]; group != nil {
+			left, ok := groupsLeft[baseline.AllowanceGroup]
+			if !ok {
+				left = u.allowanceGroupLeft(group, result)
+				groupsLeft[baseline.AllowanceGroup] = left
+			}
+
+			if left != nil {
+				allowed = decimal.Min(allowed, *left)
+				*left = left.Sub(decimal.Max(decimal.Zero, allowed))
+			}
+		}
+
+		allowed = decimal.Max(decimal.Zero, allowed)
+		result = result.Sub(allowed)
+		deductions[i] = TaxAllowanceDeduction{
+			AllowanceType: allowance.AllowanceType,
+			Claimed:       allowance.Amount,
+			Allowed:       allowed,
+		}
+	}
+
+	return result, deductions, nil
+}
+
+func (u *taxUsecase) CalculateTaxByTaxLevel(income decimal.Decimal, rule tax.RuleFilter) (decimal.Decimal, []EachTaxLevel, error) {
+	taxLevels, err := u.GetTaxLevel(rule)
+	if err != nil {
+		return decimal.Zero, nil, fmt.Errorf("failed to calculate tax: %v", err)
+	}
+
+	result, taxLevels := u.WalkTaxLevels(income, taxLevels)
+	return result, taxLevels, nil
+}
+
+// WalkTaxLevels taxes each slice of income at its own level percent, a slice starts where the previous level ends.
+// The tax of each level is rounded to satang before it is added to the total.
+func (u *taxUsecase) WalkTaxLevels(income decimal.Decimal, taxLevels []EachTaxLevel) (decimal.Decimal, []EachTaxLevel) {
+	result := make([]EachTaxLevel, 0, len(taxLevels))
+
+	totalTax, lowerBound := decimal.Zero, decimal.Zero
+	for i, level := range taxLevels {
+		if i == 0 {
+			lowerBound = level.MinIncome
+		}
+
+		upperBound := income
+		if level.MaxIncome != nil {
+			upperBound = decimal.Min(income, *level.MaxIncome)
+		}
+
+		level.TaxableIncome = decimal.Max(decimal.Zero, upperBound.Sub(lowerBound))
+		level.Tax = u.rounding.Round(level.TaxableIncome.Mul(level.TaxPercent).Div(decimal.NewFromInt(100)))
+		totalTax = totalTax.Add(level.Tax)
+
+		result = append(result, level)
+		if level.MaxIncome != nil {
+			lowerBound = *level.MaxIncome
+		}
+	}
+
+	return totalTax, result
+}
+
+func (u *taxUsecase) SetValueToTaxLevel(taxLevels []EachTaxLevel) []TaxLevelResponse {
+	result := make([]TaxLevelResponse, 0, len(taxLevels))
+	for _, level := range taxLevels {
+		result = append(result, TaxLevelResponse{
+			Level:         level.Level,
+			TaxableIncome: level.TaxableIncome,
+			TaxPercent:    level.TaxPercent,
+			Tax:           level.Tax,
+		})
+	}
+
+	return result
+}
+
+// validateIncomes checks the incomes of the request and sets the total income and wht to their sums,
+// a total income or wht that is sent together with the incomes must match the sum.
+func (u *taxUsecase) validateIncomes(req *CalculateTaxRequest) error {
+	if len(req.Incomes) == 0 {
+		return nil
+	}
+
+	totalIncome, wht := decimal.Zero, decimal.Zero
+	for _, income := range req.Incomes {
+		if !tax.IsIncomeType(income.IncomeType) {
+			return fmt.Errorf("income type %s is not supported", income.IncomeType)
+		}
+
+		if income.IncomeType == tax.IncomeTypeDividend {
+			return errors.New("dividend income must be sent in dividends instead of incomes")
+		}
+
+		if income.Amount.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("amount of %s income must be greater than zero", income.IncomeType)
+		}
+
+		if income.Wht.IsNegative() || income.Wht.GreaterThan(income.Amount) {
+			return fmt.Errorf("wht of %s income must be between 0 and its amount", income.IncomeType)
+		}
+
+		totalIncome = totalIncome.Add(income.Amount)
+		wht = wht.Add(income.Wht)
+	}
+
+	if !req.TotalIncome.IsZero() && !req.TotalIncome.Equal(totalIncome) {
+		return errors.New("total income must be the sum of incomes")
+	}
+
+	if !req.Wht.IsZero() && !req.Wht.Equal(wht) {
+		return errors.New("wht must be the sum of wht of incomes")
+	}
+
+	req.TotalIncome, req.Wht = totalIncome, wht
+	return nil
+}
+
+// ValidateCalculateTaxRequest also fills in the tax year and effective time that the request is calculated with,
+// it stops at the first problem of the request.
+func (u *taxUsecase) ValidateCalculateTaxRequest(req *CalculateTaxRequest) error {
+	if rowErrors := u.validateCalculateTaxRequest(req, false); len(rowErrors) > 0 {
+		return errors.New(rowErrors[0].Message)
+	}
+
+	return nil
+}
+
+// ValidateCalculateTaxRequestFields returns every problem of the request, the column of a problem is the field that it
+// belongs to (totalIncome, wht or the allowance type) and is empty when it is not about one field.
+func (u *taxUsecase) ValidateCalculateTaxRequestFields(req *CalculateTaxRequest) []RowError {
+	return u.validateCalculateTaxRequest(req, true)
+}
+
+func (u *taxUsecase) validateCalculateTaxRequest(req *CalculateTaxRequest, all bool) []RowError {
+	var result []RowError
+	// add keeps the problem and reports whether the validation has to stop
+	add := func(column string, err error) bool {
+		result = append(result, RowError{Line: req.Line, Column: column, Message: err.Error()})
+		return !all
+	}
+
+	// the total income and wht are the sums of the incomes, they can't be checked when the incomes are invalid
+	if err := u.validateIncomes(req); err != nil {
+		add("", err)
+		return result
+	}
+
+	if err := u.validateDividends(req); err != nil {
+		add("", err)
+		return result
+	}
+
+	if req.TotalIncome.IsNegative() || (req.TotalIncome.IsZero() && len(req.Dividends) == 0) {
+		if add(tax.CSVColumnTotalIncome, errors.New("total income must be gather than zero")) {
+			return result
+		}
+	}
+
+	if req.Wht.IsNegative() || req.Wht.GreaterThan(req.TotalIncome) {
+		if add(tax.CSVColumnWht, errors.New("wht must be between 0 and total income")) {
+			return result
+		}
+	}
+
+	taxYear, err := u.ResolveTaxYear(req.TaxYear)
+	if err != nil {
+		add("", err)
+		return result
+	}
+	req.TaxYear = taxYear
+
+	if req.EffectiveAt.IsZero() {
+		req.EffectiveAt = time.Now()
+	}
+
+	if err := u.validateTaxpayer(req); err != nil {
+		if add("", err) {
+			return result
+		}
+	}
+
+	// each allowance is limited on its own, an allowance type listed twice would get its max amount twice
+	allowanceTypes := make(map[string]bool, len(req.Allowances))
+	for _, allowance := range req.Allowances {
+		if allowanceTypes[allowance.AllowanceType] {
+			if add(allowance.AllowanceType, fmt.Errorf("allowance type %s must be listed only once", allowance.AllowanceType)) {
+				return result
+			}
+			continue
+		}
+		allowanceTypes[allowance.AllowanceType] = true
+
+		if err := u.ValidateAllowance(allowance, req.RuleFilter()); err != nil {
+			if add(allowance.AllowanceType, err) {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// calculateExpenses sums the incomes of each income type and deducts the expense of the income type from it. The income
+// exemption is taken off the incomes in the order of the request before their expenses are calculated, it returns the
+// exemption that was used. Income types that share an expense deduction share its max amount, each of them gets what
+// the deduction grows by when its income is added.
+func (u *taxUsecase) calculateExpenses(req *CalculateTaxRequest, exemption decimal.Decimal) ([]TaxIncomeResponse, decimal.Decimal, error) {
+	var result []TaxIncomeResponse
+	indexes := make(map[string]int)
+	for _, income := range u.incomeDetails(req) {
+		i, ok := indexes[income.IncomeType]
+		if !ok {
+			i = len(result)
+			indexes[income.IncomeType] = i
+			result = append(result, TaxIncomeResponse{IncomeType: income.IncomeType, Amount: decimal.Zero})
+		}
+		result[i].Amount = result[i].Amount.Add(income.Amount)
+	}
+
+	exemptionLeft := exemption
+	incomes, expenses := make(map[string]decimal.Decimal), make(map[string]decimal.Decimal)
+	for i := range result {
+		exempt := decimal.Min(exemptionLeft, result[i].Amount)
+		exemptionLeft = exemptionLeft.Sub(exempt)
+
+		expenseType := tax.ExpenseIncomeType(result[i].IncomeType)
+		incomes[expenseType] = incomes[expenseType].Add(result[i].Amount.Sub(exempt))
+		expense, err := u.CalculateExpense(incomes[expenseType], expenseType, req.RuleFilter())
+		if err != nil {
+			return nil, decimal.Zero, err
+		}
+		result[i].Expense = expense.Sub(expenses[expenseType])
+		expenses[expenseType] = expense
+	}
+
+	return result, exemption.Sub(exemptionLeft), nil
+}
+
+// CalculateTaxWithoutWHT takes the income exemption off the gross income first, then deducts the expenses of the incomes
+// that are left, the automatic allowances, the allowances of the dependents and the allowances of the request. The tax by
+// tax level is then compared with the minimum tax of the income that is not salary and the higher one is used.
+func (u *taxUsecase) CalculateTaxWithoutWHT(req *CalculateTaxRequest) (*TaxResult, error) {
+	exemption, err := u.IncomeExemption(req)
+	if err != nil {
+		return nil, err
+	}
+
+	incomes, exemption, err := u.calculateExpenses(req, exemption)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	result = math.Max(0, result)
 
-	result = u.DecreaseAllowance(result, req.Allowances)
-	result = math.Max(0, result)
+	result, expense := exemption.Neg(), decimal.Zero
+	for _, income := range incomes {
+		result = result.Add(income.Amount).Sub(income.Expense)
+		expense = expense.Add(income.Expense)
+	}
+	result = decimal.Max(decimal.Zero, result)
 
-	result, err = u.CalculateTaxByTaxLevel(result)
+	result, err = u.DecreaseAutomaticAllowances(result, req.RuleFilter())
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	result = decimal.Max(decimal.Zero, result)
+
+	dependentAllowances, err := u.DependentAllowances(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, allowance := range dependentAllowances {
+		result = result.Sub(allowance.Amount)
+	}
+	result = decimal.Max(decimal.Zero, result)
+
+	result, allowances, err := u.DecreaseAllowance(result, req)
+	if err != nil {
+		return nil, err
+	}
+	result = decimal.Max(decimal.Zero, result)
+
+	bracketTax, taxLevels, err := u.CalculateTaxByTaxLevel(result, req.RuleFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	minimumTax, err := u.CalculateMinimumTax(incomes, u.taxCredit(req), req.RuleFilter())
+	if err != nil {
+		return nil, err
+	}
+
+	totalTax, method := bracketTax, tax.TaxMethodBracket
+	if minimumTax != nil && minimumTax.GreaterThan(bracketTax) {
+		totalTax, method = *minimumTax, tax.TaxMethodMinimum
+	}
+
+	return &TaxResult{
+		Tax:                 totalTax,
+		Method:              method,
+		BracketTax:          bracketTax,
+		MinimumTax:          minimumTax,
+		TaxLevels:           taxLevels,
+		Incomes:             incomes,
+		Expense:             expense,
+		Exemption:           exemption,
+		TaxCredit:           u.taxCredit(req),
+		DependentAllowances: dependentAllowances,
+		Allowances:          allowances,
+	}, nil
+}
+
+// CalculateBulkTax calculates a row of a bulk calculation, the tax and the refund are never negative.
+func (u *taxUsecase) CalculateBulkTax(req *CalculateTaxRequest, source string) (TaxCalculationRecord, error) {
+	taxResult, err := u.CalculateTaxWithoutWHT(req)
+	if err != nil {
+		return TaxCalculationRecord{}, err
+	}
+
+	result := u.DecreaseWHT(taxResult.Tax, req.TotalWht(), taxResult.TaxCredit)
+	totalTax := decimal.Max(result, decimal.Zero)
+	taxRefund := decimal.Max(result.Neg(), decimal.Zero)
+
+	return TaxCalculationRecord{
+		Source:  source,
+		Request: req,
+		Response: TaxBulkResult{
+			Row:        req.Line,
+			Status:     tax.BulkResultCalculated,
+			Input:      req,
+			Expense:    &taxResult.Expense,
+			Allowances: taxResult.Allowances,
+			TaxMethod:  taxResult.Method,
+			BracketTax: &taxResult.BracketTax,
+			MinimumTax: taxResult.MinimumTax,
+			Tax:        &totalTax,
+			TaxRefund:  &taxRefund,
+		},
+		TotalTax:  totalTax,
+		TaxRefund: taxRefund,
+		Expense:   taxResult.Expense,
+		TaxLevels: u.SetValueToTaxLevel(taxResult.TaxLevels),
+	}, nil
+}
+
+func (u *taxUsecase) SaveTaxCalculations(records []TaxCalculationRecord) ([]tax.TaxCalculation, error) {
+	calculations := make([]tax.TaxCalculation, 0, len(records))
+	for _, record := range records {
+		request, err := json.Marshal(record.Request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tax calculation request: %v", err)
+		}
+
+		response, err := json.Marshal(record.Response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tax calculation response: %v", err)
+		}
+
+		calculations = append(calculations, tax.TaxCalculation{
+			Source:       record.Source,
+			TaxYear:      record.Request.TaxYear,
+			EffectiveAt:  record.Request.EffectiveAt,
+			RoundingMode: u.rounding.Mode(),
+			TotalIncome:  record.Request.TotalIncome,
+			TotalTax:     record.TotalTax,
+			TaxRefund:    record.TaxRefund,
+			Request:      string(request),
+			Response:     string(response),
+		})
+	}
+
+	result, err := u.taxRepository.CreateTaxCalculations(calculations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save tax calculation: %v", err)
 	}
 
 	return result, nil
 }
+
+func (u *taxUsecase) toTaxCalculationResponse(calculation *tax.TaxCalculation) TaxCalculationResponse {
+	return TaxCalculationResponse{
+		ID:           calculation.ID,
+		Source:       calculation.Source,
+		TaxYear:      calculation.TaxYear,
+		EffectiveAt:  calculation.EffectiveAt,
+		RoundingMode: calculation.RoundingMode,
+		Request:      json.RawMessage(calculation.Request),
+		Response:     json.RawMessage(calculation.Response),
+		CreatedAt:    calculation.CreatedAt,
+	}
+}
+
+func (u *taxUsecase) GetTaxCalculation(id uint) (*TaxCalculationResponse, error) {
+	calculation, err := u.taxRepository.FindTaxCalculation(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax calculation: %w", err)
+	}
+
+	result := u.toTaxCalculationResponse(calculation)
+	return &result, nil
+}
+
+func (u *taxUsecase) ListTaxCalculations(req *TaxCalculationFilter) (*TaxCalculationListResponse, error) {
+	calculations, total, err := u.taxRepository.FindTaxCalculations(&tax.TaxCalculationFilter{
+		Source:      req.Source,
+		TaxYear:     req.TaxYear,
+		CreatedFrom: req.From,
+		CreatedTo:   req.To,
+		Offset:      (req.Page - 1) * req.PageSize,
+		Limit:       req.PageSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax calculations: %v", err)
+	}
+
+	result := TaxCalculationListResponse{
+		TaxCalculations: make([]TaxCalculationResponse, 0, len(calculations)),
+		Page:            req.Page,
+		PageSize:        req.PageSize,
+		Total:           total,
+	}
+	for i := range calculations {
+		result.TaxCalculations = append(result.TaxCalculations, u.toTaxCalculationResponse(&calculations[i]))
+	}
+
+	return &result, nil
+}
@@ -1,109 +1,1189 @@
 package taxUsecases
 
 import (
+	"encoding/json"
 	"github.com/Montheankul-K/assessment-tax/modules/tax"
+	"github.com/Montheankul-K/assessment-tax/packages/money"
+	"github.com/Montheankul-K/assessment-tax/packages/worker"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"sync"
 	"testing"
+	"time"
 )
 
-type mockTaxRepository struct{}
+type mockTaxRepository struct {
+	mu           sync.Mutex
+	jobs         []tax.TaxJob
+	finished     chan uint
+	rules        []tax.RuleFilter
+	taxLevels    []tax.SetNewTaxLevels
+	calculations []tax.TaxCalculation
+	filters      []tax.TaxCalculationFilter
+}
+
+var testRule = tax.RuleFilter{
+	TaxYear:     2567,
+	EffectiveAt: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+}
 
-func (m *mockTaxRepository) FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (float64, float64, error) {
-	return 0.0, 100000.0, nil
+func maxIncome(amount int64) *decimal.Decimal {
+	result := decimal.NewFromInt(amount)
+	return &result
 }
 
-func (m *mockTaxRepository) FindTaxPercentByIncome(req *tax.TaxLevelFilter) (float64, error) {
-	return 35.0, nil
+func (m *mockTaxRepository) FindBaselineAllowanceAmount(req *tax.AllowanceFilter) (decimal.Decimal, decimal.Decimal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = append(m.rules, req.RuleFilter)
+	switch req.AllowanceType {
+	case tax.AllowanceTypeChild, tax.AllowanceTypeParent:
+		return decimal.Zero, decimal.NewFromInt(30000), nil
+	case tax.AllowanceTypeSpouse, tax.AllowanceTypeLaterChild:
+		return decimal.Zero, decimal.NewFromInt(60000), nil
+	case "health-insurance":
+		return decimal.Zero, decimal.NewFromInt(25000), nil
+	case "provident-fund", "rmf":
+		return decimal.Zero, decimal.NewFromInt(500000), nil
+	case "ssf":
+		return decimal.Zero, decimal.NewFromInt(200000), nil
+	case "social-security":
+		return decimal.Zero, decimal.NewFromInt(9000), nil
+	case tax.AllowanceTypeIncomeExemption:
+		return decimal.Zero, decimal.NewFromInt(190000), nil
+	}
+
+	return decimal.Zero, decimal.NewFromInt(100000), nil
 }
 
-func (m *mockTaxRepository) FindMaxIncomeAndPercent() (float64, float64, error) {
-	return 2000001.0, 35.0, nil
+func (m *mockTaxRepository) FindAllowance(req *tax.AllowanceFilter) (*tax.TaxAllowance, error) {
+	minAmount, maxAmount, _ := m.FindBaselineAllowanceAmount(req)
+	result := &tax.TaxAllowance{AllowanceType: req.AllowanceType, TaxYear: req.TaxYear, Enabled: true, MinAllowanceAmount: minAmount, MaxAllowanceAmount: maxAmount}
+	switch req.AllowanceType {
+	case "provident-fund":
+		result.AllowanceGroup, result.MaxIncomePercent, result.IncomeType = tax.AllowanceGroupRetirement, maxIncome(15), tax.IncomeTypeSalary
+	case "rmf", "ssf":
+		result.AllowanceGroup, result.MaxIncomePercent = tax.AllowanceGroupRetirement, maxIncome(30)
+	case "donation":
+		result.AllowanceGroup = tax.AllowanceGroupDonation
+	case "education-donation":
+		result.AllowanceGroup, result.DeductionMultiplier = tax.AllowanceGroupDonation, maxIncome(2)
+	case "life-insurance", "health-insurance":
+		result.AllowanceGroup = tax.AllowanceGroupInsurance
+	case "elderly", tax.AllowanceTypeDisabledDependent:
+		result.Enabled = false
+	}
+
+	return result, nil
 }
 
-func (m *mockTaxRepository) GetTaxLevel() ([]tax.TaxLevel, error) {
+func (m *mockTaxRepository) FindAllowanceGroup(req *tax.AllowanceGroupFilter) (*tax.TaxAllowanceGroup, error) {
+	switch req.AllowanceGroup {
+	case tax.AllowanceGroupInsurance:
+		return &tax.TaxAllowanceGroup{AllowanceGroup: req.AllowanceGroup, MaxAmount: maxIncome(100000)}, nil
+	case tax.AllowanceGroupRetirement:
+		return &tax.TaxAllowanceGroup{AllowanceGroup: req.AllowanceGroup, MaxAmount: maxIncome(500000)}, nil
+	case tax.AllowanceGroupDonation:
+		return &tax.TaxAllowanceGroup{AllowanceGroup: req.AllowanceGroup, MaxNetIncomePercent: maxIncome(10)}, nil
+	}
+
+	return nil, tax.ErrAllowanceGroupNotFound
+}
+
+func (m *mockTaxRepository) GetTaxLevel(req *tax.RuleFilter) ([]tax.TaxLevel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = append(m.rules, *req)
 	return []tax.TaxLevel{
-		{MinIncome: 0.0, MaxIncome: 150000.0},
-		{MinIncome: 150001.0, MaxIncome: 500000.0},
-		{MinIncome: 500001.0, MaxIncome: 1000000.0},
-		{MinIncome: 1000001.0, MaxIncome: 2000000.0},
-		{MinIncome: 2000001.0, MaxIncome: 2000001.0},
+		{Model: gorm.Model{ID: 1}, TaxYear: 2567, MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), TaxPercent: decimal.NewFromInt(0)},
+		{Model: gorm.Model{ID: 2}, TaxYear: 2567, MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000), TaxPercent: decimal.NewFromInt(10)},
+		{Model: gorm.Model{ID: 3}, TaxYear: 2567, MinIncome: decimal.NewFromInt(500001), MaxIncome: maxIncome(1000000), TaxPercent: decimal.NewFromInt(15)},
+		{Model: gorm.Model{ID: 4}, TaxYear: 2567, MinIncome: decimal.NewFromInt(1000001), MaxIncome: maxIncome(2000000), TaxPercent: decimal.NewFromInt(20)},
+		{Model: gorm.Model{ID: 5}, TaxYear: 2567, MinIncome: decimal.NewFromInt(2000001), MaxIncome: nil, TaxPercent: decimal.NewFromInt(35)},
 	}, nil
 }
 
-func (m *mockTaxRepository) SetDeduction(req *tax.SetNewDeductionAmount) (float64, error) {
-	return 70000.0, nil
+func (m *mockTaxRepository) FindTaxLevelByID(id uint) (*tax.TaxLevel, error) {
+	if id == 0 || id > 5 {
+		return nil, tax.ErrTaxLevelNotFound
+	}
+
+	return &tax.TaxLevel{Model: gorm.Model{ID: id}, TaxYear: 2567}, nil
 }
 
-func TestTaxUsecase_FindBaselineAllowance(t *testing.T) {
-	usecase := taxUsecase{&mockTaxRepository{}}
-	minAllowanceAmount, maxAllowanceAmount, err := usecase.taxRepository.FindBaselineAllowanceAmount(&tax.AllowanceFilter{})
+func (m *mockTaxRepository) SetTaxLevels(req *tax.SetNewTaxLevels) ([]tax.TaxLevel, error) {
+	m.taxLevels = append(m.taxLevels, *req)
+	return req.TaxLevels, nil
+}
 
-	assert.NoError(t, err)
-	assert.Equal(t, 0.0, minAllowanceAmount)
-	assert.Equal(t, 100000.0, maxAllowanceAmount)
+func (m *mockTaxRepository) FindTaxYears() ([]int, error) {
+	return []int{2566, 2567}, nil
 }
 
-func TestTaxUsecase_FindTaxPercent(t *testing.T) {
-	usecase := taxUsecase{&mockTaxRepository{}}
-	taxPercent, err := usecase.taxRepository.FindTaxPercentByIncome(&tax.TaxLevelFilter{})
+func (m *mockTaxRepository) SetDeduction(req *tax.SetNewDeductionAmount) (decimal.Decimal, error) {
+	return decimal.NewFromInt(70000), nil
+}
 
-	assert.NoError(t, err)
-	assert.Equal(t, 35.0, taxPercent)
+func (m *mockTaxRepository) FindAllowanceTypes() ([]tax.TaxAllowanceType, error) {
+	return []tax.TaxAllowanceType{
+		{AllowanceType: "personal", Source: tax.AllowanceSourceAutomatic, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: "donation", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationDonation},
+		{AllowanceType: "education-donation", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationDonation},
+		{AllowanceType: "k-receipt", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: "elderly", Source: tax.AllowanceSourceAutomatic, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: "life-insurance", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "health-insurance", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "provident-fund", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "rmf", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "ssf", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "social-security", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationCap},
+		{AllowanceType: "half-donation", Source: tax.AllowanceSourceUser, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeSpouse, Source: tax.AllowanceSourceDependents, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeChild, Source: tax.AllowanceSourceDependents, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeLaterChild, Source: tax.AllowanceSourceDependents, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeParent, Source: tax.AllowanceSourceDependents, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeDisabledDependent, Source: tax.AllowanceSourceDependents, ValidationMethod: tax.AllowanceValidationRange},
+		{AllowanceType: tax.AllowanceTypeIncomeExemption, Source: tax.AllowanceSourceTaxpayer, ValidationMethod: tax.AllowanceValidationRange},
+	}, nil
+}
+
+func (m *mockTaxRepository) FindAllowanceType(allowanceType string) (*tax.TaxAllowanceType, error) {
+	allowanceTypes, _ := m.FindAllowanceTypes()
+	for _, t := range allowanceTypes {
+		if t.AllowanceType == allowanceType {
+			return &t, nil
+		}
+	}
+
+	return nil, tax.ErrAllowanceTypeNotFound
+}
+
+func (m *mockTaxRepository) CreateAllowanceType(req *tax.SetNewAllowanceType) (*tax.TaxAllowanceType, error) {
+	return &tax.TaxAllowanceType{AllowanceType: req.AllowanceType}, nil
+}
+
+func (m *mockTaxRepository) DisableAllowanceType(req *tax.DisableAllowance) error {
+	return nil
+}
+
+func (m *mockTaxRepository) FindTaxExpense(req *tax.ExpenseFilter) (*tax.TaxExpense, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = append(m.rules, req.RuleFilter)
+	switch req.IncomeType {
+	case tax.IncomeTypeSalary:
+		return &tax.TaxExpense{IncomeType: tax.IncomeTypeSalary, TaxYear: 2567, ExpensePercent: decimal.NewFromInt(50), MaxExpenseAmount: maxIncome(100000)}, nil
+	case tax.IncomeTypeRental:
+		return &tax.TaxExpense{IncomeType: tax.IncomeTypeRental, TaxYear: 2567, ExpensePercent: decimal.NewFromInt(30)}, nil
+	case tax.IncomeTypeBusiness:
+		return &tax.TaxExpense{IncomeType: tax.IncomeTypeBusiness, TaxYear: 2567, ExpensePercent: decimal.NewFromInt(60)}, nil
+	default:
+		return nil, tax.ErrTaxExpenseNotFound
+	}
+}
+
+func (m *mockTaxRepository) FindTaxExpenses(req *tax.RuleFilter) ([]tax.TaxExpense, error) {
+	return []tax.TaxExpense{{IncomeType: tax.IncomeTypeSalary, TaxYear: 2567, ExpensePercent: decimal.NewFromInt(50), MaxExpenseAmount: maxIncome(100000)}}, nil
+}
+
+func (m *mockTaxRepository) SetTaxExpense(req *tax.SetNewTaxExpense) (*tax.TaxExpense, error) {
+	return &tax.TaxExpense{IncomeType: req.IncomeType, TaxYear: req.TaxYear, EffectiveFrom: req.EffectiveFrom, ExpensePercent: req.ExpensePercent, MaxExpenseAmount: req.MaxExpenseAmount}, nil
+}
+
+func (m *mockTaxRepository) FindMinimumTax(req *tax.RuleFilter) (*tax.TaxMinimumTax, error) {
+	if req.TaxYear != 2567 {
+		return nil, tax.ErrMinimumTaxNotFound
+	}
+
+	return &tax.TaxMinimumTax{TaxYear: 2567, MinIncome: decimal.NewFromInt(120000), TaxPercent: decimal.NewFromFloat(0.5), MaxExemptTax: decimal.NewFromInt(5000)}, nil
 }
 
-func TestTaxUsecase_FindMaxIncomeAndPercent(t *testing.T) {
-	usecase := taxUsecase{&mockTaxRepository{}}
-	maxIncome, taxPercent, err := usecase.taxRepository.FindMaxIncomeAndPercent()
+func (m *mockTaxRepository) SetMinimumTax(req *tax.SetNewMinimumTax) (*tax.TaxMinimumTax, error) {
+	return &tax.TaxMinimumTax{TaxYear: req.TaxYear, EffectiveFrom: req.EffectiveFrom, MinIncome: req.MinIncome, TaxPercent: req.TaxPercent, MaxExemptTax: req.MaxExemptTax}, nil
+}
+
+func (m *mockTaxRepository) FindDependentRule(req *tax.RuleFilter) (*tax.TaxDependentRule, error) {
+	if req.TaxYear != 2567 {
+		return nil, tax.ErrDependentRuleNotFound
+	}
+
+	return &tax.TaxDependentRule{
+		TaxYear:            2567,
+		MaxParents:         4,
+		MinParentAge:       60,
+		MaxChildAge:        20,
+		MaxStudentAge:      25,
+		LaterChildBornFrom: time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		MaxDependentIncome: decimal.NewFromInt(30000),
+	}, nil
+}
+
+func (m *mockTaxRepository) SetDependentRule(req *tax.SetNewDependentRule) (*tax.TaxDependentRule, error) {
+	return &tax.TaxDependentRule{TaxYear: req.TaxYear, EffectiveFrom: req.EffectiveFrom, MaxParents: req.MaxParents, MinParentAge: req.MinParentAge, MaxChildAge: req.MaxChildAge, MaxStudentAge: req.MaxStudentAge, LaterChildBornFrom: req.LaterChildBornFrom, MaxDependentIncome: req.MaxDependentIncome}, nil
+}
+
+func (m *mockTaxRepository) CreateTaxCalculations(calculations []tax.TaxCalculation) ([]tax.TaxCalculation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range calculations {
+		calculations[i].ID = uint(len(m.calculations) + 1)
+		m.calculations = append(m.calculations, calculations[i])
+	}
+
+	return calculations, nil
+}
+
+func (m *mockTaxRepository) FindTaxCalculation(id uint) (*tax.TaxCalculation, error) {
+	if id == 0 || int(id) > len(m.calculations) {
+		return nil, tax.ErrTaxCalculationNotFound
+	}
+
+	return &m.calculations[id-1], nil
+}
+
+func (m *mockTaxRepository) FindTaxCalculations(req *tax.TaxCalculationFilter) ([]tax.TaxCalculation, int64, error) {
+	m.filters = append(m.filters, *req)
+	return m.calculations, int64(len(m.calculations)), nil
+}
+
+func (m *mockTaxRepository) CreateTaxJob(totalRows int) (*tax.TaxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs = append(m.jobs, tax.TaxJob{Model: gorm.Model{ID: uint(len(m.jobs) + 1)}, Status: tax.TaxJobPending, TotalRows: totalRows})
+	job := m.jobs[len(m.jobs)-1]
+	return &job, nil
+}
+
+func (m *mockTaxRepository) FindTaxJob(id uint) (*tax.TaxJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id == 0 || int(id) > len(m.jobs) {
+		return nil, tax.ErrTaxJobNotFound
+	}
+
+	job := m.jobs[id-1]
+	return &job, nil
+}
+
+func (m *mockTaxRepository) SetTaxJobProgress(id uint, processedRows int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[id-1].Status = tax.TaxJobRunning
+	m.jobs[id-1].ProcessedRows = max(m.jobs[id-1].ProcessedRows, processedRows)
+	return nil
+}
+
+func (m *mockTaxRepository) FinishTaxJob(id uint, status string, result *string, message string) error {
+	m.mu.Lock()
+	m.jobs[id-1].Status, m.jobs[id-1].Result, m.jobs[id-1].Message = status, result, message
+	m.mu.Unlock()
+
+	m.finished <- id
+	return nil
+}
+
+func (m *mockTaxRepository) FailUnfinishedTaxJobs(message string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for i := range m.jobs {
+		if m.jobs[i].Status == tax.TaxJobPending || m.jobs[i].Status == tax.TaxJobRunning {
+			m.jobs[i].Status, m.jobs[i].Message = tax.TaxJobFailed, message
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func newTestTaxUsecase() taxUsecase {
+	return taxUsecase{
+		taxRepository: &mockTaxRepository{},
+		rounding:      money.NewRounding(money.RoundHalfUp),
+	}
+}
+
+func TestTaxUsecase_ResolveTaxYear(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name            string
+		taxYear         int
+		expectedTaxYear int
+		expectedErr     bool
+	}{
+		{name: "latest tax year", taxYear: 0, expectedTaxYear: 2567},
+		{name: "prior tax year", taxYear: 2566, expectedTaxYear: 2566},
+		{name: "unknown tax year", taxYear: 2500, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := usecase.ResolveTaxYear(tc.taxYear)
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTaxYear, result)
+		})
+	}
+}
+
+func TestTaxUsecase_FindBaselineAllowance(t *testing.T) {
+	usecase := newTestTaxUsecase()
+	minAllowanceAmount, maxAllowanceAmount, err := usecase.taxRepository.FindBaselineAllowanceAmount(&tax.AllowanceFilter{})
 
 	assert.NoError(t, err)
-	assert.Equal(t, 2000001.0, maxIncome)
-	assert.Equal(t, 35.0, taxPercent)
+	assert.Equal(t, decimal.Zero, minAllowanceAmount)
+	assert.Equal(t, decimal.NewFromInt(100000), maxAllowanceAmount)
 }
 
 func TestTaxUsecase_ConstructTaxLevels(t *testing.T) {
-	usecase := taxUsecase{&mockTaxRepository{}}
+	usecase := newTestTaxUsecase()
 
-	maxIncomeAmount := 2000001.0
 	taxLevels := []tax.TaxLevel{
-		{MinIncome: 0.0, MaxIncome: 150000.0},
-		{MinIncome: 150001.0, MaxIncome: 500000.0},
-		{MinIncome: 500001.0, MaxIncome: 1000000.0},
-		{MinIncome: 1000001.0, MaxIncome: 2000000.0},
-		{MinIncome: 2000001.0, MaxIncome: 2000001.0},
+		{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000)},
+		{MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000)},
+		{MinIncome: decimal.NewFromInt(500001), MaxIncome: maxIncome(1000000)},
+		{MinIncome: decimal.NewFromInt(1000001), MaxIncome: maxIncome(2000000)},
+		{MinIncome: decimal.NewFromInt(2000001), MaxIncome: nil},
 	}
 
 	expectedTaxLevels := []EachTaxLevel{
-		{MinMax: []float64{0.0, 150000.0}, Level: "0-150000", Tax: 0.0},
-		{MinMax: []float64{150001.0, 500000.0}, Level: "150001-500000", Tax: 0.0},
-		{MinMax: []float64{500001.0, 1000000.0}, Level: "500001-1000000", Tax: 0.0},
-		{MinMax: []float64{1000001.0, 2000000.0}, Level: "1000001-2000000", Tax: 0.0},
-		{MinMax: []float64{2000001.0, 2000001.0}, Level: "2000001 ขึ้นไป", Tax: 0.0},
+		{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), Level: "0-150000", Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000), Level: "150001-500000", Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(500001), MaxIncome: maxIncome(1000000), Level: "500001-1000000", Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(1000001), MaxIncome: maxIncome(2000000), Level: "1000001-2000000", Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(2000001), MaxIncome: nil, Level: "2000001 ขึ้นไป", Tax: decimal.Zero},
 	}
 
-	result := usecase.ConstructTaxLevels(maxIncomeAmount, taxLevels)
+	result := usecase.ConstructTaxLevels(taxLevels)
 	assert.Equal(t, expectedTaxLevels, result)
 }
 
 func TestTaxUsecase_GetTaxLevel(t *testing.T) {
-	usecase := taxUsecase{&mockTaxRepository{}}
+	usecase := newTestTaxUsecase()
 
 	expectedTaxLevels := []EachTaxLevel{
-		{MinMax: []float64{0.0, 150000.0}, Level: "0-150000", Tax: 0.0},
-		{MinMax: []float64{150001.0, 500000.0}, Level: "150001-500000", Tax: 0.0},
-		{MinMax: []float64{500001.0, 1000000.0}, Level: "500001-1000000", Tax: 0.0},
-		{MinMax: []float64{1000001.0, 2000000.0}, Level: "1000001-2000000", Tax: 0.0},
-		{MinMax: []float64{2000001.0, 2000001.0}, Level: "2000001 ขึ้นไป", Tax: 0.0},
+		{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), Level: "0-150000", TaxPercent: decimal.NewFromInt(0), Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000), Level: "150001-500000", TaxPercent: decimal.NewFromInt(10), Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(500001), MaxIncome: maxIncome(1000000), Level: "500001-1000000", TaxPercent: decimal.NewFromInt(15), Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(1000001), MaxIncome: maxIncome(2000000), Level: "1000001-2000000", TaxPercent: decimal.NewFromInt(20), Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(2000001), MaxIncome: nil, Level: "2000001 ขึ้นไป", TaxPercent: decimal.NewFromInt(35), Tax: decimal.Zero},
 	}
 
-	taxLevels, err := usecase.GetTaxLevel()
+	taxLevels, err := usecase.GetTaxLevel(testRule)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedTaxLevels, taxLevels)
 }
 
 func TestTaxUsecase_SetDeduction(t *testing.T) {
-	taxRepository := taxUsecase{&mockTaxRepository{}}
-	result, err := taxRepository.SetDeduction(&tax.SetNewDeductionAmount{})
+	taxRepository := newTestTaxUsecase()
+	result, err := taxRepository.SetDeduction(&tax.SetNewDeductionAmount{AllowanceType: "personal"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, decimal.NewFromInt(70000), result)
+
+	_, err = taxRepository.SetDeduction(&tax.SetNewDeductionAmount{AllowanceType: "elderly"})
+	assert.ErrorIs(t, err, tax.ErrAllowanceTypeUnavailable)
+
+	_, err = taxRepository.SetDeduction(&tax.SetNewDeductionAmount{AllowanceType: "unknown"})
+	assert.ErrorIs(t, err, tax.ErrAllowanceTypeNotFound)
+}
+
+func TestTaxUsecase_DecreaseAutomaticAllowances(t *testing.T) {
+	usecase := newTestTaxUsecase()
+	result, err := usecase.DecreaseAutomaticAllowances(decimal.NewFromInt(600000), testRule)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "500000", result.String())
+}
+
+func TestTaxUsecase_CalculateTaxByTaxLevel(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name                   string
+		income                 string
+		expectedTax            string
+		expectedLevels         []string
+		expectedTaxableIncomes []string
+	}{
+		{name: "exempt level", income: "150000", expectedTax: "0", expectedLevels: []string{"0", "0", "0", "0", "0"}, expectedTaxableIncomes: []string{"150000", "0", "0", "0", "0"}},
+		{name: "second level", income: "440000", expectedTax: "29000", expectedLevels: []string{"0", "29000", "0", "0", "0"}, expectedTaxableIncomes: []string{"150000", "290000", "0", "0", "0"}},
+		{name: "third level", income: "750000", expectedTax: "72500", expectedLevels: []string{"0", "35000", "37500", "0", "0"}, expectedTaxableIncomes: []string{"150000", "350000", "250000", "0", "0"}},
+		{name: "top level", income: "3000000", expectedTax: "660000", expectedLevels: []string{"0", "35000", "75000", "200000", "350000"}, expectedTaxableIncomes: []string{"150000", "350000", "500000", "1000000", "1000000"}},
+		{name: "satang", income: "150000.15", expectedTax: "0.02", expectedLevels: []string{"0", "0.02", "0", "0", "0"}, expectedTaxableIncomes: []string{"150000", "0.15", "0", "0", "0"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, taxLevels, err := usecase.CalculateTaxByTaxLevel(decimal.RequireFromString(tc.income), testRule)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTax, result.String())
+			assert.Len(t, taxLevels, len(tc.expectedLevels))
+			for i, level := range taxLevels {
+				assert.Equal(t, tc.expectedLevels[i], level.Tax.String())
+				assert.Equal(t, tc.expectedTaxableIncomes[i], level.TaxableIncome.String())
+			}
+		})
+	}
+}
+
+func TestTaxUsecase_CalculateTaxByTaxLevel_Rounding(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mode        string
+		expectedTax string
+	}{
+		{name: "half up", mode: money.RoundHalfUp, expectedTax: "0.03"},
+		{name: "half even", mode: money.RoundHalfEven, expectedTax: "0.02"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			usecase := taxUsecase{
+				taxRepository: &mockTaxRepository{},
+				rounding:      money.NewRounding(tc.mode),
+			}
+
+			result, _, err := usecase.CalculateTaxByTaxLevel(decimal.RequireFromString("150000.25"), testRule)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTax, result.String())
+		})
+	}
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{
+		taxRepository: repository,
+		rounding:      money.NewRounding(money.RoundHalfUp),
+	}
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(600000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(60000)},
+		},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "100000", result.Expense.String())
+	assert.Equal(t, "21000", result.Tax.String())
+	for _, rule := range repository.rules {
+		assert.Equal(t, testRule, rule)
+	}
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_Incomes(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		Incomes: []TaxIncomeDetails{
+			{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(100000)},
+			{IncomeType: tax.IncomeTypeRental, Amount: decimal.NewFromInt(200000)},
+			{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(200000)},
+			{IncomeType: tax.IncomeTypeInterest, Amount: decimal.NewFromInt(100000)},
+		},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "160000", result.Expense.String())
+	assert.Equal(t, "19000", result.Tax.String())
+	assert.Len(t, result.Incomes, 3)
+	assert.Equal(t, tax.IncomeTypeSalary, result.Incomes[0].IncomeType)
+	assert.Equal(t, "300000", result.Incomes[0].Amount.String())
+	assert.Equal(t, "100000", result.Incomes[0].Expense.String())
+	assert.Equal(t, "60000", result.Incomes[1].Expense.String())
+	assert.Equal(t, "0", result.Incomes[2].Expense.String())
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_FreelanceExpense(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		Incomes: []TaxIncomeDetails{
+			{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(150000)},
+			{IncomeType: tax.IncomeTypeFreelance, Amount: decimal.NewFromInt(100000)},
+		},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "100000", result.Expense.String())
+	assert.Equal(t, "75000", result.Incomes[0].Expense.String())
+	assert.Equal(t, "25000", result.Incomes[1].Expense.String())
+}
+
+func TestTaxUsecase_CalculateTaxWithoutWHT_MinimumTax(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		Incomes: []TaxIncomeDetails{
+			{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(1300000)},
+		},
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "rmf", Amount: decimal.NewFromInt(390000)},
+			{AllowanceType: "life-insurance", Amount: decimal.NewFromInt(100000)},
+		},
+	}
+
+	result, err := usecase.CalculateTaxWithoutWHT(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, tax.TaxMethodMinimum, result.Method)
+	assert.Equal(t, "0", result.BracketTax.String())
+	assert.Equal(t, "6500", result.MinimumTax.String())
+	assert.Equal(t, "6500", result.Tax.String())
+}
+
+func TestTaxUsecase_CalculateMinimumTax(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name      string
+		incomes   []TaxIncomeResponse
+		taxCredit decimal.Decimal
+		rule      tax.RuleFilter
+		expected  string
+	}{
+		{name: "salary only", incomes: []TaxIncomeResponse{{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(5000000)}}, rule: testRule},
+		{name: "freelance", incomes: []TaxIncomeResponse{{IncomeType: tax.IncomeTypeFreelance, Amount: decimal.NewFromInt(5000000)}}, rule: testRule, expected: "25000"},
+		{name: "below min income", incomes: []TaxIncomeResponse{{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(100000)}}, rule: testRule},
+		{name: "waived", incomes: []TaxIncomeResponse{{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(1000000)}}, rule: testRule},
+		{name: "no minimum tax", incomes: []TaxIncomeResponse{{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(2000000)}}, rule: tax.RuleFilter{TaxYear: 2566}},
+		{
+			name: "income that is not salary",
+			incomes: []TaxIncomeResponse{
+				{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(1000000)},
+				{IncomeType: tax.IncomeTypeRental, Amount: decimal.NewFromInt(1500000)},
+				{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(500000)},
+			},
+			rule:     testRule,
+			expected: "10000",
+		},
+		{
+			name: "dividend without its tax credit",
+			incomes: []TaxIncomeResponse{
+				{IncomeType: tax.IncomeTypeBusiness, Amount: decimal.NewFromInt(1300000)},
+				{IncomeType: tax.IncomeTypeDividend, Amount: decimal.NewFromInt(100000)},
+			},
+			taxCredit: decimal.NewFromInt(20000),
+			rule:      testRule,
+			expected:  "6900",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := usecase.CalculateMinimumTax(tc.incomes, tc.taxCredit, tc.rule)
+
+			assert.NoError(t, err)
+			if tc.expected == "" {
+				assert.Nil(t, result)
+				return
+			}
+			assert.Equal(t, tc.expected, result.String())
+		})
+	}
+}
+
+func TestTaxUsecase_ValidateCalculateTaxRequest_Incomes(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name                string
+		totalIncome         int64
+		wht                 int64
+		incomes             []TaxIncomeDetails
+		expectedTotalIncome string
+		expectedWht         string
+		expectedErr         bool
+	}{
+		{
+			name: "sum of incomes",
+			incomes: []TaxIncomeDetails{
+				{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(300000), Wht: decimal.NewFromInt(10000)},
+				{IncomeType: tax.IncomeTypeProfessional, Amount: decimal.NewFromInt(50000), Wht: decimal.NewFromInt(1500)},
+			},
+			expectedTotalIncome: "350000",
+			expectedWht:         "11500",
+		},
+		{
+			name:        "total income matches incomes",
+			totalIncome: 300000,
+			incomes: []TaxIncomeDetails{
+				{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(300000)},
+			},
+			expectedTotalIncome: "300000",
+			expectedWht:         "0",
+		},
+		{
+			name:        "total income does not match incomes",
+			totalIncome: 500000,
+			incomes:     []TaxIncomeDetails{{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(300000)}},
+			expectedErr: true,
+		},
+		{
+			name:        "wht does not match incomes",
+			wht:         1000,
+			incomes:     []TaxIncomeDetails{{IncomeType: tax.IncomeTypeSalary, Amount: decimal.NewFromInt(300000)}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown income type",
+			incomes:     []TaxIncomeDetails{{IncomeType: "lottery", Amount: decimal.NewFromInt(300000)}},
+			expectedErr: true,
+		},
+		{
+			name:        "dividend in incomes",
+			incomes:     []TaxIncomeDetails{{IncomeType: tax.IncomeTypeDividend, Amount: decimal.NewFromInt(100000)}},
+			expectedErr: true,
+		},
+		{
+			name:        "wht over income",
+			incomes:     []TaxIncomeDetails{{IncomeType: tax.IncomeTypeRental, Amount: decimal.NewFromInt(1000), Wht: decimal.NewFromInt(2000)}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &CalculateTaxRequest{
+				TaxYear:     testRule.TaxYear,
+				TotalIncome: decimal.NewFromInt(tc.totalIncome),
+				Wht:         decimal.NewFromInt(tc.wht),
+				Incomes:     tc.incomes,
+			}
+
+			err := usecase.ValidateCalculateTaxRequest(req)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedTotalIncome, req.TotalIncome.String())
+			assert.Equal(t, tc.expectedWht, req.Wht.String())
+		})
+	}
+}
+
+func TestTaxUsecase_ValidateCalculateTaxRequest_DuplicateAllowance(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		TotalIncome: decimal.NewFromInt(500000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(100000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(10000)},
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(100000)},
+		},
+	}
+
+	err := usecase.ValidateCalculateTaxRequest(req)
+
+	assert.EqualError(t, err, "allowance type donation must be listed only once")
+}
+
+func TestTaxUsecase_ValidateCalculateTaxRequestFields(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		Line:        3,
+		TaxYear:     testRule.TaxYear,
+		TotalIncome: decimal.NewFromInt(500000),
+		Wht:         decimal.NewFromInt(600000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(-1)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(10000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(10000)},
+		},
+	}
+
+	result := usecase.ValidateCalculateTaxRequestFields(req)
+
+	assert.Len(t, result, 3)
+	assert.Equal(t, RowError{Line: 3, Column: tax.CSVColumnWht, Message: "wht must be between 0 and total income"}, result[0])
+	assert.Equal(t, 3, result[1].Line)
+	assert.Equal(t, "donation", result[1].Column)
+	assert.Equal(t, RowError{Line: 3, Column: "k-receipt", Message: "allowance type k-receipt must be listed only once"}, result[2])
+	assert.EqualError(t, usecase.ValidateCalculateTaxRequest(req), "wht must be between 0 and total income")
+}
+
+func TestTaxUsecase_CalculateBulkTax_Refund(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{
+		taxRepository: repository,
+		rounding:      money.NewRounding(money.RoundHalfUp),
+	}
+
+	req := &CalculateTaxRequest{
+		Line:        3,
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(600000),
+		Wht:         decimal.NewFromInt(40000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(60000)},
+		},
+	}
+
+	record, err := usecase.CalculateBulkTax(req, tax.CalculationSourceCSV)
+
+	assert.NoError(t, err)
+	assert.Equal(t, tax.CalculationSourceCSV, record.Source)
+	assert.Equal(t, "0", record.TotalTax.String())
+	assert.Equal(t, "19000", record.TaxRefund.String())
+	assert.NotEmpty(t, record.TaxLevels)
+
+	result := record.BulkResult()
+	assert.Equal(t, 3, result.Row)
+	assert.Equal(t, tax.BulkResultCalculated, result.Status)
+	assert.Equal(t, req, result.Input)
+	assert.Equal(t, "0", result.Tax.String())
+	assert.Equal(t, "19000", result.TaxRefund.String())
+	assert.Equal(t, "100000", result.Expense.String())
+}
+
+func TestTaxUsecase_CalculateExpense(t *testing.T) {
+	testCases := []struct {
+		name       string
+		income     string
+		incomeType string
+		expected   string
+	}{
+		{name: "half of income", income: "150000", incomeType: tax.IncomeTypeSalary, expected: "75000"},
+		{name: "max expense", income: "600000", incomeType: tax.IncomeTypeSalary, expected: "100000"},
+		{name: "satang", income: "100000.25", incomeType: tax.IncomeTypeSalary, expected: "50000.13"},
+		{name: "no expense", income: "600000", incomeType: "interest", expected: "0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			usecase := taxUsecase{taxRepository: &mockTaxRepository{}, rounding: money.NewRounding(money.RoundHalfUp)}
+
+			result, err := usecase.CalculateExpense(decimal.RequireFromString(tc.income), tc.incomeType, testRule)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result.String())
+		})
+	}
+}
+
+func TestNewRejectedTaxBulkResults(t *testing.T) {
+	result := NewRejectedTaxBulkResults([]RowError{
+		{Line: 5, Message: "wht must be between 0 and total income"},
+		{Line: 3, Column: "wht", Message: "could not parse wht"},
+		{Line: 3, Column: "donation", Message: "could not parse donation"},
+	})
+
+	assert.Len(t, result, 2)
+	assert.Equal(t, 3, result[0].Row)
+	assert.Equal(t, tax.BulkResultRejected, result[0].Status)
+	assert.Len(t, result[0].Errors, 2)
+	assert.Nil(t, result[0].Tax)
+	assert.Equal(t, 5, result[1].Row)
+}
+
+func TestTaxUsecase_DecreaseWHT(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	result := usecase.DecreaseWHT(decimal.RequireFromString("0.1"), decimal.RequireFromString("0.3"), decimal.Zero)
+	assert.Equal(t, "-0.2", result.String())
+}
+
+func TestTaxUsecase_SetValueToTaxLevel(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	taxLevels := []EachTaxLevel{
+		{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), Level: "0-150000", TaxPercent: decimal.NewFromInt(0), TaxableIncome: decimal.NewFromInt(150000), Tax: decimal.Zero},
+		{MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000), Level: "150001-500000", TaxPercent: decimal.NewFromInt(10), TaxableIncome: decimal.NewFromInt(290000), Tax: decimal.NewFromInt(29000)},
+	}
+
+	expectedResult := []TaxLevelResponse{
+		{Level: "0-150000", TaxableIncome: decimal.NewFromInt(150000), TaxPercent: decimal.NewFromInt(0), Tax: decimal.Zero},
+		{Level: "150001-500000", TaxableIncome: decimal.NewFromInt(290000), TaxPercent: decimal.NewFromInt(10), Tax: decimal.NewFromInt(29000)},
+	}
+
+	result := usecase.SetValueToTaxLevel(taxLevels)
+	assert.Equal(t, expectedResult, result)
+}
+
+func TestTaxUsecase_ValidateTaxLevels(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name        string
+		taxLevels   []tax.TaxLevel
+		expectedErr bool
+	}{
+		{name: "contiguous levels", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(150001), MaxIncome: nil, TaxPercent: decimal.NewFromInt(10)},
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), TaxPercent: decimal.NewFromInt(0)},
+		}},
+		{name: "no level", taxLevels: []tax.TaxLevel{}, expectedErr: true},
+		{name: "not start at zero", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(1), MaxIncome: nil, TaxPercent: decimal.NewFromInt(10)},
+		}, expectedErr: true},
+		{name: "overlap", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), TaxPercent: decimal.NewFromInt(0)},
+			{MinIncome: decimal.NewFromInt(100000), MaxIncome: nil, TaxPercent: decimal.NewFromInt(10)},
+		}, expectedErr: true},
+		{name: "gap", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), TaxPercent: decimal.NewFromInt(0)},
+			{MinIncome: decimal.NewFromInt(200000), MaxIncome: nil, TaxPercent: decimal.NewFromInt(10)},
+		}, expectedErr: true},
+		{name: "open-ended level in the middle", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: nil, TaxPercent: decimal.NewFromInt(0)},
+			{MinIncome: decimal.NewFromInt(150001), MaxIncome: nil, TaxPercent: decimal.NewFromInt(10)},
+		}, expectedErr: true},
+		{name: "bounded last level", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: maxIncome(150000), TaxPercent: decimal.NewFromInt(0)},
+			{MinIncome: decimal.NewFromInt(150001), MaxIncome: maxIncome(500000), TaxPercent: decimal.NewFromInt(10)},
+		}, expectedErr: true},
+		{name: "percent over 100", taxLevels: []tax.TaxLevel{
+			{MinIncome: decimal.NewFromInt(0), MaxIncome: nil, TaxPercent: decimal.NewFromInt(101)},
+		}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taxLevels := make([]tax.TaxLevel, len(tc.taxLevels))
+			copy(taxLevels, tc.taxLevels)
+			err := usecase.ValidateTaxLevels(tc.taxLevels)
+			assert.Equal(t, taxLevels, tc.taxLevels)
+
+			if tc.expectedErr {
+				assert.ErrorIs(t, err, tax.ErrInvalidTaxLevels)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTaxUsecase_CreateTaxLevel(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{taxRepository: repository, rounding: money.NewRounding(money.RoundHalfUp)}
+
+	_, err := usecase.CreateTaxLevel(&tax.SetNewTaxLevel{
+		TaxYear:       2567,
+		EffectiveFrom: testRule.EffectiveAt,
+		MinIncome:     decimal.NewFromInt(1000000),
+		TaxPercent:    decimal.NewFromInt(50),
+	})
+
+	assert.ErrorIs(t, err, tax.ErrInvalidTaxLevels)
+	assert.Empty(t, repository.taxLevels)
+}
+
+func TestTaxUsecase_UpdateTaxLevel(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{taxRepository: repository, rounding: money.NewRounding(money.RoundHalfUp)}
+
+	result, err := usecase.UpdateTaxLevel(5, &tax.SetNewTaxLevel{
+		EffectiveFrom: testRule.EffectiveAt,
+		MinIncome:     decimal.NewFromInt(2000001),
+		TaxPercent:    decimal.NewFromInt(40),
+	})
 
 	assert.NoError(t, err)
-	assert.Equal(t, 70000.0, result)
+	assert.Len(t, result, 5)
+	assert.Equal(t, "40", result[4].TaxPercent.String())
+	assert.Equal(t, 2567, repository.taxLevels[0].TaxYear)
+
+	_, err = usecase.UpdateTaxLevel(9, &tax.SetNewTaxLevel{EffectiveFrom: testRule.EffectiveAt})
+	assert.ErrorIs(t, err, tax.ErrTaxLevelNotFound)
+}
+
+func TestTaxUsecase_DeleteTaxLevel(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{taxRepository: repository, rounding: money.NewRounding(money.RoundHalfUp)}
+
+	testCases := []struct {
+		name        string
+		id          uint
+		expectedMin []string
+		expectedMax []string
+	}{
+		{name: "last level", id: 5, expectedMin: []string{"0", "150001", "500001", "1000001"}, expectedMax: []string{"150000", "500000", "1000000", ""}},
+		{name: "middle level", id: 3, expectedMin: []string{"0", "150001", "1000001", "2000001"}, expectedMax: []string{"150000", "1000000", "2000000", ""}},
+		{name: "first level", id: 1, expectedMin: []string{"0", "500001", "1000001", "2000001"}, expectedMax: []string{"500000", "1000000", "2000000", ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := usecase.DeleteTaxLevel(tc.id, testRule.EffectiveAt)
+			assert.NoError(t, err)
+			assert.Len(t, result, 4)
+
+			for i, level := range result {
+				assert.Equal(t, tc.expectedMin[i], level.MinIncome.String())
+				if level.IsOpenEnded() {
+					assert.Empty(t, tc.expectedMax[i])
+					continue
+				}
+				assert.Equal(t, tc.expectedMax[i], level.MaxIncome.String())
+			}
+		})
+	}
+
+	assert.Len(t, repository.taxLevels, 3)
+}
+
+type halfAllowanceRule struct{}
+
+func (halfAllowanceRule) Validate(allowance TaxAllowanceDetails, baseline AllowanceBaseline) error {
+	return nil
+}
+
+func (halfAllowanceRule) Deduct(allowance TaxAllowanceDetails, baseline AllowanceBaseline, netIncome decimal.Decimal) decimal.Decimal {
+	return decimal.Min(allowance.Amount, netIncome.Div(decimal.NewFromInt(2)))
+}
+
+func TestTaxUsecase_DecreaseAllowance(t *testing.T) {
+	RegisterAllowanceRule("half-donation", halfAllowanceRule{})
+	usecase := newTestTaxUsecase()
+
+	testCases := []struct {
+		name        string
+		allowances  []TaxAllowanceDetails
+		expected    string
+		expectedErr bool
+	}{
+		{name: "range rule", allowances: []TaxAllowanceDetails{{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(60000)}}, expected: "440000"},
+		{name: "cap rule", allowances: []TaxAllowanceDetails{{AllowanceType: "life-insurance", Amount: decimal.NewFromInt(150000)}}, expected: "400000"},
+		{name: "registered rule", allowances: []TaxAllowanceDetails{{AllowanceType: "half-donation", Amount: decimal.NewFromInt(400000)}}, expected: "250000"},
+		{name: "automatic allowance", allowances: []TaxAllowanceDetails{{AllowanceType: "personal", Amount: decimal.NewFromInt(60000)}}, expectedErr: true},
+		{name: "unknown allowance", allowances: []TaxAllowanceDetails{{AllowanceType: "unknown", Amount: decimal.NewFromInt(60000)}}, expectedErr: true},
+		{name: "dependent allowance", allowances: []TaxAllowanceDetails{{AllowanceType: tax.AllowanceTypeSpouse, Amount: decimal.NewFromInt(60000)}}, expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &CalculateTaxRequest{TaxYear: testRule.TaxYear, EffectiveAt: testRule.EffectiveAt, TotalIncome: decimal.NewFromInt(500000), Allowances: tc.allowances}
+			result, _, err := usecase.DecreaseAllowance(decimal.NewFromInt(500000), req)
+
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result.String())
+		})
+	}
+}
+
+func TestTaxUsecase_DecreaseAllowance_CombinedCaps(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(1000000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "life-insurance", Amount: decimal.NewFromInt(90000)},
+			{AllowanceType: "health-insurance", Amount: decimal.NewFromInt(30000)},
+			{AllowanceType: "provident-fund", Amount: decimal.NewFromInt(200000)},
+			{AllowanceType: "rmf", Amount: decimal.NewFromInt(400000)},
+			{AllowanceType: "ssf", Amount: decimal.NewFromInt(100000)},
+			{AllowanceType: "social-security", Amount: decimal.NewFromInt(10000)},
+		},
+	}
+
+	result, deductions, err := usecase.DecreaseAllowance(decimal.NewFromInt(800000), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "191000", result.String())
+	expectedAllowed := []string{"90000", "10000", "150000", "300000", "50000", "9000"}
+	assert.Len(t, deductions, len(expectedAllowed))
+	for i, deduction := range deductions {
+		assert.Equal(t, req.Allowances[i].AllowanceType, deduction.AllowanceType)
+		assert.Equal(t, req.Allowances[i].Amount, deduction.Claimed)
+		assert.Equal(t, expectedAllowed[i], deduction.Allowed.String())
+	}
+}
+
+func TestTaxUsecase_DecreaseAllowance_Donations(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	req := &CalculateTaxRequest{
+		TaxYear:     testRule.TaxYear,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(500000),
+		Allowances: []TaxAllowanceDetails{
+			{AllowanceType: "donation", Amount: decimal.NewFromInt(30000)},
+			{AllowanceType: "education-donation", Amount: decimal.NewFromInt(20000)},
+			{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(50000)},
+		},
+	}
+
+	result, deductions, err := usecase.DecreaseAllowance(decimal.NewFromInt(500000), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "405000", result.String())
+	expectedAllowed := []string{"30000", "15000", "50000"}
+	assert.Len(t, deductions, len(expectedAllowed))
+	for i, deduction := range deductions {
+		assert.Equal(t, req.Allowances[i].AllowanceType, deduction.AllowanceType)
+		assert.Equal(t, req.Allowances[i].Amount, deduction.Claimed)
+		assert.Equal(t, expectedAllowed[i], deduction.Allowed.String())
+	}
+}
+
+func TestTaxUsecase_ValidateAllowance(t *testing.T) {
+	usecase := newTestTaxUsecase()
+
+	assert.NoError(t, usecase.ValidateAllowance(TaxAllowanceDetails{AllowanceType: "life-insurance", Amount: decimal.NewFromInt(150000)}, testRule))
+	assert.Error(t, usecase.ValidateAllowance(TaxAllowanceDetails{AllowanceType: "k-receipt", Amount: decimal.NewFromInt(150000)}, testRule))
+	assert.Error(t, usecase.ValidateAllowance(TaxAllowanceDetails{AllowanceType: "elderly", Amount: decimal.Zero}, testRule))
+}
+
+func TestTaxUsecase_SaveTaxCalculations(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{taxRepository: repository, rounding: money.NewRounding(money.RoundHalfEven)}
+
+	req := &CalculateTaxRequest{
+		TaxYear:     2567,
+		EffectiveAt: testRule.EffectiveAt,
+		TotalIncome: decimal.NewFromInt(500000),
+		Wht:         decimal.Zero,
+		Allowances:  []TaxAllowanceDetails{{AllowanceType: "donation", Amount: decimal.Zero}},
+	}
+	result, err := usecase.SaveTaxCalculations([]TaxCalculationRecord{
+		{Source: tax.CalculationSourceAPI, Request: req, Response: TaxResponse{Tax: decimal.NewFromInt(29000)}, TotalTax: decimal.NewFromInt(29000)},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, money.RoundHalfEven, result[0].RoundingMode)
+	assert.Equal(t, 2567, result[0].TaxYear)
+
+	calculation, err := usecase.GetTaxCalculation(result[0].ID)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"taxYear":2567,"effectiveAt":"2024-01-01T00:00:00Z","totalIncome":"500000","wht":"0","allowances":[{"allowanceType":"donation","amount":"0"}]}`, string(calculation.Request))
+
+	_, err = usecase.GetTaxCalculation(9)
+	assert.ErrorIs(t, err, tax.ErrTaxCalculationNotFound)
+}
+
+func TestTaxUsecase_ListTaxCalculations(t *testing.T) {
+	repository := &mockTaxRepository{}
+	usecase := taxUsecase{taxRepository: repository, rounding: money.NewRounding(money.RoundHalfUp)}
+
+	result, err := usecase.ListTaxCalculations(&TaxCalculationFilter{Source: tax.CalculationSourceCSV, Page: 3, PageSize: 20})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Page)
+	assert.Equal(t, tax.TaxCalculationFilter{Source: tax.CalculationSourceCSV, Offset: 40, Limit: 20}, repository.filters[0])
+}
+
+func TestTaxJobUsecase_SubmitTaxJob(t *testing.T) {
+	repository := &mockTaxRepository{finished: make(chan uint, 1)}
+	usecase := TaxJobUsecase(repository, TaxUsecase(repository, money.NewRounding(money.RoundHalfUp)), worker.NewPool(2))
+
+	reqs := make([]CalculateTaxRequest, 0, taxJobChunkSize+1)
+	for i := 0; i < taxJobChunkSize+1; i++ {
+		reqs = append(reqs, CalculateTaxRequest{TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero})
+	}
+
+	job, err := usecase.SubmitTaxJob(reqs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tax.TaxJobPending, job.Status)
+
+	<-repository.finished
+	result, err := usecase.GetTaxJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tax.TaxJobDone, result.Status)
+	assert.Equal(t, "100", result.Progress.String())
+	assert.Equal(t, "/tax/jobs/1/result", result.ResultUrl)
+	assert.Len(t, repository.calculations, taxJobChunkSize+1)
+
+	data, err := usecase.GetTaxJobResult(job.ID)
+	assert.NoError(t, err)
+	var rows []TaxBulkResult
+	assert.NoError(t, json.Unmarshal(data, &rows))
+	assert.Len(t, rows, taxJobChunkSize+1)
+	assert.Equal(t, tax.BulkResultCalculated, rows[0].Status)
+	assert.Equal(t, "15000", rows[0].Tax.String())
+}
+
+func TestTaxJobUsecase_SubmitTaxJob_InvalidRow(t *testing.T) {
+	repository := &mockTaxRepository{finished: make(chan uint, 1)}
+	usecase := TaxJobUsecase(repository, TaxUsecase(repository, money.NewRounding(money.RoundHalfUp)), worker.NewPool(1))
+
+	job, err := usecase.SubmitTaxJob([]CalculateTaxRequest{
+		{Line: 2, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.Zero},
+		{Line: 4, TotalIncome: decimal.NewFromInt(500000), Wht: decimal.NewFromInt(600000)},
+	}, []RowError{{Line: 3, Column: "totalIncome", Message: "could not parse totalIncome"}})
+	assert.NoError(t, err)
+
+	<-repository.finished
+	result, err := usecase.GetTaxJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tax.TaxJobDone, result.Status)
+	assert.Len(t, repository.calculations, 1)
+
+	data, err := usecase.GetTaxJobResult(job.ID)
+	assert.NoError(t, err)
+	var rows []TaxBulkResult
+	assert.NoError(t, json.Unmarshal(data, &rows))
+	assert.Len(t, rows, 3)
+	assert.Equal(t, 2, rows[0].Row)
+	assert.Equal(t, tax.BulkResultCalculated, rows[0].Status)
+	assert.Equal(t, 3, rows[1].Row)
+	assert.Equal(t, tax.BulkResultRejected, rows[1].Status)
+	assert.Equal(t, 4, rows[2].Row)
+	assert.Equal(t, tax.BulkResultRejected, rows[2].Status)
+	assert.Equal(t, 4, rows[2].Errors[0].Line)
+}
+
+func TestTaxJobUsecase_FailUnfinishedTaxJobs(t *testing.T) {
+	repository := &mockTaxRepository{jobs: []tax.TaxJob{
+		{Model: gorm.Model{ID: 1}, Status: tax.TaxJobDone},
+		{Model: gorm.Model{ID: 2}, Status: tax.TaxJobRunning},
+		{Model: gorm.Model{ID: 3}, Status: tax.TaxJobPending},
+	}}
+	usecase := TaxJobUsecase(repository, TaxUsecase(repository, money.NewRounding(money.RoundHalfUp)), worker.NewPool(1))
+
+	_, err := usecase.SubmitTaxJob(nil, nil)
+	assert.ErrorIs(t, err, tax.ErrTaxJobEmpty)
+
+	assert.NoError(t, usecase.FailUnfinishedTaxJobs())
+	assert.Equal(t, tax.TaxJobDone, repository.jobs[0].Status)
+	assert.Equal(t, tax.TaxJobFailed, repository.jobs[1].Status)
+	assert.Equal(t, tax.TaxJobFailed, repository.jobs[2].Status)
+	assert.NotEmpty(t, repository.jobs[2].Message)
 }
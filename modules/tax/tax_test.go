@@ -0,0 +1,43 @@
+package tax
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func amount(value int64) *decimal.Decimal {
+	result := decimal.NewFromInt(value)
+	return &result
+}
+
+func TestTaxAllowance_WithMaxAmount(t *testing.T) {
+	testCases := []struct {
+		name        string
+		allowance   TaxAllowance
+		amount      decimal.Decimal
+		expectedMin string
+		expectedErr error
+	}{
+		{name: "fixed allowance moves its min amount", allowance: TaxAllowance{AllowanceType: "personal", MinAllowanceAmount: decimal.NewFromInt(60000), MaxAllowanceAmount: decimal.NewFromInt(60000)}, amount: decimal.NewFromInt(50000), expectedMin: "50000"},
+		{name: "range allowance keeps its min amount", allowance: TaxAllowance{AllowanceType: "k-receipt", MinAllowanceAmount: decimal.Zero, MaxAllowanceAmount: decimal.NewFromInt(50000)}, amount: decimal.NewFromInt(70000), expectedMin: "0"},
+		{name: "not greater than admin min amount", allowance: TaxAllowance{AllowanceType: "personal", MinAllowanceAmount: decimal.NewFromInt(60000), MaxAllowanceAmount: decimal.NewFromInt(60000), AdminMinAmount: amount(10000), AdminMaxAmount: amount(100000)}, amount: decimal.NewFromInt(10000), expectedErr: ErrInvalidDeductionAmount},
+		{name: "greater than admin max amount", allowance: TaxAllowance{AllowanceType: "k-receipt", MinAllowanceAmount: decimal.Zero, MaxAllowanceAmount: decimal.NewFromInt(50000), AdminMinAmount: amount(0), AdminMaxAmount: amount(100000)}, amount: decimal.NewFromInt(100001), expectedErr: ErrInvalidDeductionAmount},
+		{name: "within admin amounts", allowance: TaxAllowance{AllowanceType: "k-receipt", MinAllowanceAmount: decimal.Zero, MaxAllowanceAmount: decimal.NewFromInt(50000), AdminMinAmount: amount(0), AdminMaxAmount: amount(100000)}, amount: decimal.NewFromInt(100000), expectedMin: "0"},
+		{name: "max amount below min amount", allowance: TaxAllowance{AllowanceType: "social-security", MinAllowanceAmount: decimal.NewFromInt(1000), MaxAllowanceAmount: decimal.NewFromInt(9000)}, amount: decimal.NewFromInt(500), expectedErr: ErrInvalidDeductionAmount},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tc.allowance.WithMaxAmount(tc.amount)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMin, result.MinAllowanceAmount.String())
+			assert.Equal(t, tc.amount.String(), result.MaxAllowanceAmount.String())
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package csvinput
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EncodingAuto       = "auto"
+	EncodingUTF8       = "utf-8"
+	EncodingTIS620     = "tis-620"
+	EncodingWindows874 = "windows-874"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	delimiters = []rune{',', ';', '\t', '|'}
+
+	thousandsComma = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})+(\.\d+)?$`)
+	thousandsDot   = regexp.MustCompile(`^[+-]?\d{1,3}((\.\d{3}){2,}(,\d+)?|\.\d{3},\d+)$`)
+)
+
+func IsSupportedEncoding(encoding string) bool {
+	switch strings.ToLower(encoding) {
+	case EncodingAuto, EncodingUTF8, EncodingTIS620, EncodingWindows874:
+		return true
+	}
+
+	return false
+}
+
+// NewReader decodes src to UTF-8, drops the BOM and uses the delimiter found in the first line.
+// With the auto encoding a file that is not valid UTF-8 is read as Windows-874, which covers TIS-620.
+func NewReader(src io.Reader, encoding string) (*csv.Reader, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %v", err)
+	}
+
+	encoding = strings.ToLower(encoding)
+	if encoding == "" || encoding == EncodingAuto {
+		encoding = EncodingUTF8
+		if !utf8.Valid(data) {
+			encoding = EncodingWindows874
+		}
+	}
+
+	switch encoding {
+	case EncodingUTF8:
+		if !utf8.Valid(data) {
+			return nil, errors.New("file is not utf-8 encoded")
+		}
+	case EncodingTIS620, EncodingWindows874:
+		data, err = charmap.Windows874.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s file: %v", encoding, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", encoding)
+	}
+
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = sniffDelimiter(data)
+	return reader, nil
+}
+
+// sniffDelimiter returns the delimiter that is used the most outside of quotes in the first line.
+func sniffDelimiter(data []byte) rune {
+	counts := make(map[rune]int, len(delimiters))
+	quoted := false
+	for _, r := range string(data) {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted && (r == '\n' || r == '\r') {
+			break
+		}
+		if !quoted {
+			counts[r]++
+		}
+	}
+
+	result := delimiters[0]
+	for _, delimiter := range delimiters {
+		if counts[delimiter] > counts[result] {
+			result = delimiter
+		}
+	}
+
+	return result
+}
+
+// ParseAmount parses an amount written with thousands separators such as "1,500,000.00" or "1.500.000,00",
+// a single comma that is not a thousands separator is read as the decimal separator and "1.500" stays 1.5.
+func ParseAmount(value string) (decimal.Decimal, error) {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "฿", "").Replace(strings.TrimSpace(value))
+
+	switch {
+	case thousandsComma.MatchString(value):
+		value = strings.ReplaceAll(value, ",", "")
+	case thousandsDot.MatchString(value):
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	case strings.Count(value, ",") == 1 && !strings.Contains(value, "."):
+		value = strings.Replace(value, ",", ".", 1)
+	}
+
+	return decimal.NewFromString(value)
+}
@@ -0,0 +1,46 @@
+package money
+
+import "github.com/shopspring/decimal"
+
+const (
+	RoundHalfUp   = "half-up"
+	RoundHalfEven = "half-even"
+	SatangPlaces  = 2
+)
+
+type IRounding interface {
+	Mode() string
+	Round(amount decimal.Decimal) decimal.Decimal
+}
+
+type rounding struct {
+	mode   string
+	places int32
+}
+
+func NewRounding(mode string) IRounding {
+	if !IsSupportedRoundingMode(mode) {
+		mode = RoundHalfUp
+	}
+
+	return &rounding{
+		mode:   mode,
+		places: SatangPlaces,
+	}
+}
+
+func IsSupportedRoundingMode(mode string) bool {
+	return mode == RoundHalfUp || mode == RoundHalfEven
+}
+
+func (r *rounding) Mode() string {
+	return r.mode
+}
+
+func (r *rounding) Round(amount decimal.Decimal) decimal.Decimal {
+	if r.mode == RoundHalfEven {
+		return amount.RoundBank(r.places)
+	}
+
+	return amount.Round(r.places)
+}
@@ -0,0 +1,44 @@
+package money
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRounding_Round(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mode     string
+		amount   string
+		expected string
+	}{
+		{name: "half-up 0.005", mode: RoundHalfUp, amount: "0.005", expected: "0.01"},
+		{name: "half-up 0.015", mode: RoundHalfUp, amount: "0.015", expected: "0.02"},
+		{name: "half-up 0.025", mode: RoundHalfUp, amount: "0.025", expected: "0.03"},
+		{name: "half-up 0.004", mode: RoundHalfUp, amount: "0.004", expected: "0"},
+		{name: "half-up -0.005", mode: RoundHalfUp, amount: "-0.005", expected: "-0.01"},
+		{name: "half-up -0.025", mode: RoundHalfUp, amount: "-0.025", expected: "-0.03"},
+		{name: "half-even 0.005", mode: RoundHalfEven, amount: "0.005", expected: "0"},
+		{name: "half-even 0.015", mode: RoundHalfEven, amount: "0.015", expected: "0.02"},
+		{name: "half-even 0.025", mode: RoundHalfEven, amount: "0.025", expected: "0.02"},
+		{name: "half-even 0.0251", mode: RoundHalfEven, amount: "0.0251", expected: "0.03"},
+		{name: "half-even -0.005", mode: RoundHalfEven, amount: "-0.005", expected: "0"},
+		{name: "half-even -0.015", mode: RoundHalfEven, amount: "-0.015", expected: "-0.02"},
+		{name: "half-even -0.025", mode: RoundHalfEven, amount: "-0.025", expected: "-0.02"},
+		{name: "unsupported mode falls back to half-up", mode: "ceiling", amount: "0.025", expected: "0.03"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := NewRounding(tc.mode).Round(decimal.RequireFromString(tc.amount))
+			assert.Equal(t, tc.expected, result.String())
+		})
+	}
+}
+
+func TestNewRounding_Mode(t *testing.T) {
+	assert.Equal(t, RoundHalfUp, NewRounding(RoundHalfUp).Mode())
+	assert.Equal(t, RoundHalfEven, NewRounding(RoundHalfEven).Mode())
+	assert.Equal(t, RoundHalfUp, NewRounding("").Mode())
+}
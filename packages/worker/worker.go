@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+type IPool interface {
+	Submit(task func()) error
+	Shutdown(ctx context.Context) error
+}
+
+type pool struct {
+	tasks  chan func()
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPool starts size workers, Submit blocks while all workers are busy and the queue is full.
+func NewPool(size int) IPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &pool{
+		tasks: make(chan func(), size*2),
+	}
+
+	p.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *pool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		task()
+	}
+}
+
+func (p *pool) Submit(task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	p.tasks <- task
+	return nil
+}
+
+// Shutdown stops accepting tasks and waits for the queued tasks to finish.
+func (p *pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}